@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	translate "github.com/OwO-Network/DeepLX/translate"
+)
+
+// ChatContent is the content of a chat message, either a string or an array of
+// parts as in [{"type":"text","text":"..."}]. Text parts are joined by line breaks,
+// images and other parts are ignored.
+type ChatContent string
+
+func (cc *ChatContent) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*cc = ""
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*cc = ChatContent(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*cc = ChatContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// languageAliases are names of languages that differ from the names in the language table
+var languageAliases = map[string]string{
+	"simplified chinese":   "ZH-HANS",
+	"traditional chinese":  "ZH-HANT",
+	"mandarin":             "ZH",
+	"british english":      "EN-GB",
+	"american english":     "EN-US",
+	"brazilian portuguese": "PT-BR",
+	"european portuguese":  "PT-PT",
+	"norwegian":            "NB",
+}
+
+// lookupLanguageName finds the language s starts with, by name such as "Japanese" or
+// "English (British)" or by code such as "ja" or "en-GB", and returns its code
+func lookupLanguageName(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	startsWith := func(name string) bool {
+		if !strings.HasPrefix(s, name) {
+			return false
+		}
+		// The name must end at a word boundary, "en" is not the start of "english"
+		rest := s[len(name):]
+		return rest == "" || !isWordByte(rest[0])
+	}
+
+	code, longest := "", 0
+	for name, aliasCode := range languageAliases {
+		if len(name) > longest && startsWith(name) {
+			code, longest = aliasCode, len(name)
+		}
+	}
+	for _, lang := range translate.Languages() {
+		for _, name := range []string{strings.ToLower(lang.Name), strings.ToLower(lang.Code)} {
+			if len(name) > longest && startsWith(name) {
+				code, longest = lang.Code, len(name)
+			}
+		}
+	}
+	return code, code != ""
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '-' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// chatInstructions are the settings a system prompt can ask for
+type chatInstructions struct {
+	sourceLang   string
+	targetLang   string
+	formality    translate.Formality
+	glossary     string
+	keepMarkdown bool
+}
+
+var (
+	instructionTarget   = regexp.MustCompile(`(?i)(?:\btranslat\w*\b[^\n.]*?\b(?:to|into)|\btarget[ _]lang(?:uage)?\s*[:=])\s*(\S[^\n]*)`)
+	instructionSource   = regexp.MustCompile(`(?i)(?:\btranslat\w*\b[^\n.]*?\bfrom|\bsource[ _]lang(?:uage)?\s*[:=])\s*(\S[^\n]*)`)
+	instructionInformal = regexp.MustCompile(`(?i)\b(?:informal|casual|formality\s*[:=]\s*less)\b`)
+	instructionFormal   = regexp.MustCompile(`(?i)\b(?:formal|polite|formality\s*[:=]\s*more)\b`)
+	instructionGlossary = regexp.MustCompile(`(?i)(?:\b(?:use|apply)\s+(?:the\s+)?glossary(?:\s+(?:named|called))?|\bglossary\s*[:=]|\bglossary\s+(?:named|called))\s*["'“]?(\w+(?:[.-]\w+)*)`)
+	instructionMarkdown = regexp.MustCompile(`(?i)\b(?:keep|preserve|retain|maintain)\b[^\n.]*\bmarkdown\b`)
+)
+
+// parseInstructions reads what a system prompt asks for: "Translate from English into Japanese",
+// "target_lang: ja", "Use a formal tone", "Use the glossary legal-terms" or "Keep the markdown".
+// Glossaries are only named explicitly, a prompt merely mentioning one names none.
+// Languages it cannot name are left empty.
+func parseInstructions(prompt string) chatInstructions {
+	var instr chatInstructions
+	if m := instructionTarget.FindStringSubmatch(prompt); m != nil {
+		instr.targetLang, _ = lookupLanguageName(m[1])
+	}
+	if m := instructionSource.FindStringSubmatch(prompt); m != nil {
+		if code, ok := lookupLanguageName(m[1]); ok {
+			// Regional variants are only targets, their language is the source
+			code, _, _ = strings.Cut(code, "-")
+			instr.sourceLang = code
+		}
+	}
+	switch {
+	case instructionInformal.MatchString(prompt):
+		instr.formality = translate.FormalityInformal
+	case instructionFormal.MatchString(prompt):
+		instr.formality = translate.FormalityFormal
+	}
+	if m := instructionGlossary.FindStringSubmatch(prompt); m != nil {
+		instr.glossary = m[1]
+	}
+	instr.keepMarkdown = instructionMarkdown.MatchString(prompt)
+	return instr
+}
+
+// markdownPrefix matches the block syntax at the start of a line: headings, quotes, list items and task boxes
+var markdownPrefix = regexp.MustCompile(`^\s*(?:#{1,6}\s+|>\s?|[-*+]\s+(?:\[[ xX]\]\s+)?|\d+[.)]\s+)*`)
+
+// markdownRule matches a thematic break such as --- or ***
+var markdownRule = regexp.MustCompile(`^\s*([-*_])(?:\s*[-*_]){2,}\s*$`)
+
+// markdownText is a markdown document with the syntax that must survive translation taken out.
+// Fenced code blocks and rules are kept verbatim, headings, quotes and list markers are put
+// back in front of their translated line. This relies on the line structure being preserved.
+type markdownText struct {
+	text     string   // what is translated, one line per line of the document
+	prefixes []string // syntax taken out of every line, whole lines for code
+}
+
+func newMarkdownText(s string) *markdownText {
+	lines := strings.Split(s, "\n")
+	md := &markdownText{prefixes: make([]string, len(lines))}
+	texts := make([]string, len(lines))
+	fenced := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			md.prefixes[i] = line
+			continue
+		}
+		if fenced || markdownRule.MatchString(line) {
+			md.prefixes[i] = line
+			continue
+		}
+		prefix := markdownPrefix.FindString(line)
+		md.prefixes[i] = prefix
+		texts[i] = line[len(prefix):]
+	}
+	md.text = strings.Join(texts, "\n")
+	return md
+}
+
+func (md *markdownText) prefix(line int) string {
+	if line < len(md.prefixes) {
+		return md.prefixes[line]
+	}
+	return ""
+}
+
+// restore puts the syntax back into the translation of md.text, a translation
+// that lost the line structure is returned as is
+func (md *markdownText) restore(translation string) string {
+	lines := strings.Split(translation, "\n")
+	if len(lines) != len(md.prefixes) {
+		return translation
+	}
+	for i := range lines {
+		lines[i] = md.prefixes[i] + lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stream returns an emit function that puts the syntax back into a streamed translation
+func (md *markdownText) stream(emit func(string) error) func(string) error {
+	line, started := 0, false
+	return func(delta string) error {
+		var b strings.Builder
+		for {
+			if !started {
+				started = true
+				b.WriteString(md.prefix(line))
+			}
+			text, rest, found := strings.Cut(delta, "\n")
+			b.WriteString(text)
+			if !found {
+				break
+			}
+			b.WriteString("\n")
+			line, started, delta = line+1, false, rest
+		}
+		return emit(b.String())
+	}
+}
@@ -16,20 +16,67 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	IP        string
-	Port      int
-	Token     string
-	DlSession string
-	Proxy     string
+	IP          string
+	Port        int
+	Token       string
+	DlSession   string // comma separated
+	Proxy       string // comma separated
+	RedisURL    string
+	Concurrency int
+	BatchPolicy string
+	DetectMode  string
+	CacheSize   int
+	CacheTTL    time.Duration
+	TMPath      string
+
+	SessionFile     string
+	SessionStrategy string
+	SessionCooldown time.Duration
+
+	ProxyStrategy string
+	ProxyEjection time.Duration
+
+	Retries    string
+	RetryDelay time.Duration
+
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	Providers   string // comma separated, tried in order
+	DeepLAPIKey string
+	DeepLAPIURL string
+	LibreURL    string
+	LibreAPIKey string
+	LLMURL      string
+	LLMAPIKey   string
+	LLMModel    string
+
+	ModelAliases string // comma separated name=model[:formality]
 }
 
+// Names of the translation providers
+const (
+	providerDeepLX   = "deeplx"
+	providerOfficial = "official"
+	providerLibre    = "libre"
+	providerGoogle   = "google"
+	providerLLM      = "llm"
+)
+
 func initConfig() *Config {
 	cfg := &Config{
-		IP:   "0.0.0.0",
-		Port: 1188,
+		IP:          "0.0.0.0",
+		Port:        1188,
+		Concurrency: 4,
+		CacheTTL:    time.Hour,
+
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
 	}
 
 	// IP flag
@@ -47,13 +94,33 @@ func initConfig() *Config {
 	flag.IntVar(&cfg.Port, "p", cfg.Port, "set up the port to listen on")
 
 	// DL Session flag
-	flag.StringVar(&cfg.DlSession, "s", "", "set the dl-session for /v1/translate endpoint")
+	flag.StringVar(&cfg.DlSession, "s", "", "set the dl-session for /v1/translate endpoint, several are separated by commas")
 	if cfg.DlSession == "" {
 		if dlSession, ok := os.LookupEnv("DL_SESSION"); ok {
 			cfg.DlSession = dlSession
 		}
 	}
 
+	// Session pool flags
+	flag.StringVar(&cfg.SessionFile, "session-file", "", "set a file with one dl-session per line")
+	if cfg.SessionFile == "" {
+		if sessionFile, ok := os.LookupEnv("DL_SESSION_FILE"); ok {
+			cfg.SessionFile = sessionFile
+		}
+	}
+	flag.StringVar(&cfg.SessionStrategy, "session-strategy", "", "set how sessions are rotated: round-robin, lru or random")
+	if cfg.SessionStrategy == "" {
+		if sessionStrategy, ok := os.LookupEnv("SESSION_STRATEGY"); ok {
+			cfg.SessionStrategy = sessionStrategy
+		}
+	}
+	if sessionCooldown, ok := os.LookupEnv("SESSION_COOLDOWN"); ok && sessionCooldown != "" {
+		if cooldown, err := time.ParseDuration(sessionCooldown); err == nil {
+			cfg.SessionCooldown = cooldown
+		}
+	}
+	flag.DurationVar(&cfg.SessionCooldown, "session-cooldown", cfg.SessionCooldown, "set how long a rate limited session is benched")
+
 	// Access token flag
 	flag.StringVar(&cfg.Token, "token", "", "set the access token for /translate endpoint")
 	if cfg.Token == "" {
@@ -63,13 +130,215 @@ func initConfig() *Config {
 	}
 
 	// HTTP Proxy flag
-	flag.StringVar(&cfg.Proxy, "proxy", "", "set the proxy URL for HTTP requests")
+	flag.StringVar(&cfg.Proxy, "proxy", "", "set the proxy URL for HTTP requests, several are separated by commas")
 	if cfg.Proxy == "" {
 		if proxy, ok := os.LookupEnv("PROXY"); ok {
 			cfg.Proxy = proxy
 		}
 	}
 
+	// Proxy pool flags
+	flag.StringVar(&cfg.ProxyStrategy, "proxy-strategy", "", "set how proxies are rotated: round-robin, lru or random")
+	if cfg.ProxyStrategy == "" {
+		if proxyStrategy, ok := os.LookupEnv("PROXY_STRATEGY"); ok {
+			cfg.ProxyStrategy = proxyStrategy
+		}
+	}
+	if proxyEjection, ok := os.LookupEnv("PROXY_EJECTION"); ok && proxyEjection != "" {
+		if ejection, err := time.ParseDuration(proxyEjection); err == nil {
+			cfg.ProxyEjection = ejection
+		}
+	}
+	flag.DurationVar(&cfg.ProxyEjection, "proxy-ejection", cfg.ProxyEjection, "set how long a failing proxy is taken out of rotation")
+
+	// Retry flags
+	flag.StringVar(&cfg.Retries, "retries", "", "set the attempts per upstream call, e.g. 3 or 3,LMT_split_text=2")
+	if cfg.Retries == "" {
+		if retries, ok := os.LookupEnv("RETRIES"); ok {
+			cfg.Retries = retries
+		}
+	}
+	if retryDelay, ok := os.LookupEnv("RETRY_DELAY"); ok && retryDelay != "" {
+		if delay, err := time.ParseDuration(retryDelay); err == nil {
+			cfg.RetryDelay = delay
+		}
+	}
+	flag.DurationVar(&cfg.RetryDelay, "retry-delay", cfg.RetryDelay, "set the backoff before the first retry, it doubles for every further one")
+
+	// Circuit breaker flags
+	if breakerThreshold, ok := os.LookupEnv("BREAKER_THRESHOLD"); ok && breakerThreshold != "" {
+		fmt.Sscanf(breakerThreshold, "%d", &cfg.BreakerThreshold)
+	}
+	flag.IntVar(&cfg.BreakerThreshold, "breaker-threshold", cfg.BreakerThreshold, "set the consecutive upstream failures that stop requests to a proxy and session, 0 disables it")
+	if breakerCooldown, ok := os.LookupEnv("BREAKER_COOLDOWN"); ok && breakerCooldown != "" {
+		if cooldown, err := time.ParseDuration(breakerCooldown); err == nil {
+			cfg.BreakerCooldown = cooldown
+		}
+	}
+	flag.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", cfg.BreakerCooldown, "set how long requests are stopped before DeepL is probed again")
+
+	// Provider flags
+	flag.StringVar(&cfg.Providers, "providers", "", "set the translation providers tried in order: deeplx, official, libre, google, llm")
+	if cfg.Providers == "" {
+		if providers, ok := os.LookupEnv("PROVIDERS"); ok {
+			cfg.Providers = providers
+		}
+	}
+	flag.StringVar(&cfg.DeepLAPIKey, "api-key", "", "set the official DeepL API authentication key")
+	if cfg.DeepLAPIKey == "" {
+		if apiKey, ok := os.LookupEnv("DEEPL_API_KEY"); ok {
+			cfg.DeepLAPIKey = apiKey
+		}
+	}
+	flag.StringVar(&cfg.DeepLAPIURL, "api-url", "", "set the official DeepL API endpoint, by default it follows the key")
+	if cfg.DeepLAPIURL == "" {
+		if apiURL, ok := os.LookupEnv("DEEPL_API_URL"); ok {
+			cfg.DeepLAPIURL = apiURL
+		}
+	}
+	flag.StringVar(&cfg.LibreURL, "libre-url", "", "set the URL of a LibreTranslate compatible server")
+	if cfg.LibreURL == "" {
+		if libreURL, ok := os.LookupEnv("LIBRE_URL"); ok {
+			cfg.LibreURL = libreURL
+		}
+	}
+	flag.StringVar(&cfg.LibreAPIKey, "libre-api-key", "", "set the API key of the LibreTranslate server")
+	if cfg.LibreAPIKey == "" {
+		if apiKey, ok := os.LookupEnv("LIBRE_API_KEY"); ok {
+			cfg.LibreAPIKey = apiKey
+		}
+	}
+	flag.StringVar(&cfg.LLMURL, "llm-url", "", "set the URL of an OpenAI compatible API, e.g. https://api.openai.com/v1")
+	if cfg.LLMURL == "" {
+		if llmURL, ok := os.LookupEnv("LLM_API_URL"); ok {
+			cfg.LLMURL = llmURL
+		}
+	}
+	flag.StringVar(&cfg.LLMAPIKey, "llm-api-key", "", "set the API key of the OpenAI compatible API")
+	if cfg.LLMAPIKey == "" {
+		if apiKey, ok := os.LookupEnv("LLM_API_KEY"); ok {
+			cfg.LLMAPIKey = apiKey
+		}
+	}
+	flag.StringVar(&cfg.LLMModel, "llm-model", "", "set the model used for translations by the OpenAI compatible API")
+	if cfg.LLMModel == "" {
+		if model, ok := os.LookupEnv("LLM_MODEL"); ok {
+			cfg.LLMModel = model
+		}
+	}
+
+	// Chat completions flags
+	flag.StringVar(&cfg.ModelAliases, "model-aliases", "", "set extra chat models, e.g. translator-jp=deepl-auto-ja:formal,zh-tw=deepl-auto-zh-hant")
+	if cfg.ModelAliases == "" {
+		if aliases, ok := os.LookupEnv("MODEL_ALIASES"); ok {
+			cfg.ModelAliases = aliases
+		}
+	}
+
+	// Redis cache flag
+	flag.StringVar(&cfg.RedisURL, "redis", "", "set the Redis URL of a cache shared between instances")
+	if cfg.RedisURL == "" {
+		if redisURL, ok := os.LookupEnv("REDIS_URL"); ok {
+			cfg.RedisURL = redisURL
+		}
+	}
+
+	// Concurrency flag
+	if concurrency, ok := os.LookupEnv("CONCURRENCY"); ok && concurrency != "" {
+		fmt.Sscanf(concurrency, "%d", &cfg.Concurrency)
+	}
+	flag.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "set the number of upstream requests translated in parallel")
+
+	// Batch policy flag
+	flag.StringVar(&cfg.BatchPolicy, "batch-policy", "", "set how failing texts of a batch are handled: fail-fast or partial")
+	if cfg.BatchPolicy == "" {
+		if batchPolicy, ok := os.LookupEnv("BATCH_POLICY"); ok {
+			cfg.BatchPolicy = batchPolicy
+		}
+	}
+
+	// Detect mode flag
+	flag.StringVar(&cfg.DetectMode, "detect", "", "set how the source language is detected: deepl, once or segment (default)")
+	if cfg.DetectMode == "" {
+		if detectMode, ok := os.LookupEnv("DETECT_MODE"); ok {
+			cfg.DetectMode = detectMode
+		}
+	}
+
+	// Cache flags
+	if cacheSize, ok := os.LookupEnv("CACHE_SIZE"); ok && cacheSize != "" {
+		fmt.Sscanf(cacheSize, "%d", &cfg.CacheSize)
+	}
+	flag.IntVar(&cfg.CacheSize, "cache-size", cfg.CacheSize, "set the number of translated lines kept in memory, 0 disables the cache")
+	if cacheTTL, ok := os.LookupEnv("CACHE_TTL"); ok && cacheTTL != "" {
+		if ttl, err := time.ParseDuration(cacheTTL); err == nil {
+			cfg.CacheTTL = ttl
+		}
+	}
+	flag.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "set how long a cached translation stays valid")
+
+	// Translation memory flag
+	flag.StringVar(&cfg.TMPath, "tm-path", "", "set the file translations are persisted to, empty disables the translation memory")
+	if cfg.TMPath == "" {
+		if tmPath, ok := os.LookupEnv("TM_PATH"); ok {
+			cfg.TMPath = tmPath
+		}
+	}
+
 	flag.Parse()
 	return cfg
 }
+
+// ProviderNames returns the providers of Providers in order. By default the web client
+// is used alone, followed by the official API when a key is configured.
+func (cfg *Config) ProviderNames() []string {
+	var names []string
+	for _, name := range strings.Split(cfg.Providers, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		return names
+	}
+	if cfg.DeepLAPIKey != "" {
+		return []string{providerDeepLX, providerOfficial}
+	}
+	return []string{providerDeepLX}
+}
+
+// Proxies returns the proxy URLs of Proxy
+func (cfg *Config) Proxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(cfg.Proxy, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// Sessions returns the sessions of DlSession followed by those of SessionFile,
+// blank lines and lines starting with # are skipped
+func (cfg *Config) Sessions() ([]string, error) {
+	var sessions []string
+	for _, session := range strings.Split(cfg.DlSession, ",") {
+		if session = strings.TrimSpace(session); session != "" {
+			sessions = append(sessions, session)
+		}
+	}
+	if cfg.SessionFile == "" {
+		return sessions, nil
+	}
+
+	data, err := os.ReadFile(cfg.SessionFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			sessions = append(sessions, line)
+		}
+	}
+	return sessions, nil
+}
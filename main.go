@@ -13,15 +13,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
-	
 
 	translate "github.com/OwO-Network/DeepLX/translate"
 	"github.com/gin-contrib/cors"
@@ -63,107 +66,408 @@ func authMiddleware(cfg *Config) gin.HandlerFunc {
 }
 
 type PayloadFree struct {
-	TransText   string `json:"text"`
-	SourceLang  string `json:"source_lang"`
-	TargetLang  string `json:"target_lang"`
-	TagHandling string `json:"tag_handling"`
+	TransText   string `json:"text" form:"text"`
+	SourceLang  string `json:"source_lang" form:"source_lang"`
+	TargetLang  string `json:"target_lang" form:"target_lang"`
+	TagHandling string `json:"tag_handling" form:"tag_handling"`
+	DetectMode  string `json:"detect_mode" form:"detect_mode"`
+	NoCache     bool   `json:"no_cache" form:"no_cache"`
+	Provider    string `json:"provider" form:"provider"` // Overrides the fallback chain of Config.Providers
+}
+
+// PayloadPro is the request body of /v1/translate, the session overrides Config.DlSession
+type PayloadPro struct {
+	PayloadFree
+	DlSession string `json:"dl_session" form:"dl_session"`
 }
 
 type PayloadAPI struct {
-	Text        []string `json:"text"`
-	TargetLang  string   `json:"target_lang"`
-	SourceLang  string   `json:"source_lang"`
-	TagHandling string   `json:"tag_handling"`
+	Text        []string `json:"text" form:"text"`
+	TargetLang  string   `json:"target_lang" form:"target_lang"`
+	SourceLang  string   `json:"source_lang" form:"source_lang"`
+	TagHandling string   `json:"tag_handling" form:"tag_handling"`
+	DetectMode  string   `json:"detect_mode" form:"detect_mode"`
+	NoCache     bool     `json:"no_cache" form:"no_cache"`
+	Provider    string   `json:"provider" form:"provider"`
+}
+
+// APITranslation is a single entry of the official DeepL API response
+type APITranslation struct {
+	DetectedSourceLanguage string `json:"detected_source_language"`
+	Text                   string `json:"text"`
+	Error                  string `json:"error,omitempty"` // Only set for failed texts with the partial batch policy
 }
 type ChatCompletionRequest struct {
-    Messages []struct {
-        Role    string `json:"role"`
-        Content string `json:"content"`
-    } `json:"messages"`
-    Model string `json:"model"`
-    Stream bool   `json:"stream"`
+	Messages []struct {
+		Role    string      `json:"role"`
+		Content ChatContent `json:"content"`
+	} `json:"messages"`
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+	N      int    `json:"n"`
 }
 
+// maxChatChoices bounds n, every choice past the first is another beam asked of DeepL
+const maxChatChoices = 8
+
 type ChatCompletionResponse struct {
-    ID      string `json:"id"`
-    Object  string `json:"object"`
-    Created int64  `json:"created"`
-    Model   string `json:"model"`
-    Choices []struct {
-        Index        int `json:"index"`
-        Message     struct {
-            Role    string `json:"role"`
-            Content string `json:"content"`
-        } `json:"message"`
-        FinishReason string `json:"finish_reason"`
-    } `json:"choices"`
-    Usage struct {
-        PromptTokens     int `json:"prompt_tokens"`
-        CompletionTokens int `json:"completion_tokens"`
-        TotalTokens      int `json:"total_tokens"`
-    } `json:"usage"`
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
 }
+
+type ChatChoice struct {
+	Index   int `json:"index"`
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	FinishReason string `json:"finish_reason"`
+}
+
 type ChatCompletionChunk struct {
-    ID      string `json:"id"`
-    Object  string `json:"object"`
-    Created int64  `json:"created"`
-    Model   string `json:"model"`
-    Choices []ChunkChoice `json:"choices"`
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []ChunkChoice `json:"choices"`
 }
 
 type ChunkChoice struct {
-    Index        int         `json:"index"`
-    Delta        DeltaStruct `json:"delta"`
-    FinishReason *string     `json:"finish_reason"`
+	Index        int         `json:"index"`
+	Delta        DeltaStruct `json:"delta"`
+	FinishReason *string     `json:"finish_reason"`
 }
 
 type DeltaStruct struct {
-    Content string `json:"content"`
-    Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+	Role    string `json:"role,omitempty"`
+}
+
+// statusClientClosedRequest is the non-standard status logged when the client disconnects
+const statusClientClosedRequest = 499
+
+// errorStatus maps a translation error to an HTTP status code
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, translate.ErrEmptyText), errors.Is(err, translate.ErrUnsupportedLanguage), errors.Is(err, translate.ErrGlossaryNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, translate.ErrSessionInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, translate.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, translate.ErrUpstreamProtocol):
+		return http.StatusBadGateway
+	case errors.Is(err, translate.ErrUpstreamUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+// noCache reports whether the request asked to bypass the translation cache,
+// either with the no_cache field or a Cache-Control: no-cache header
+func noCache(c *gin.Context, field bool) bool {
+	return field || strings.Contains(strings.ToLower(c.GetHeader("Cache-Control")), "no-cache")
+}
+
+// setCacheHeader reports in X-DeepLX-Cache whether the lines were served from the cache
+func setCacheHeader(c *gin.Context, hits, misses int) {
+	switch {
+	case hits == 0 && misses == 0:
+		// No cache configured or nothing to translate
+	case misses == 0:
+		c.Header("X-DeepLX-Cache", "HIT")
+	case hits == 0:
+		c.Header("X-DeepLX-Cache", "MISS")
+	default:
+		c.Header("X-DeepLX-Cache", "PARTIAL")
+	}
+}
+
+// setAttemptsHeader reports in X-DeepLX-Attempts how many upstream requests were made, retries included
+func setAttemptsHeader(c *gin.Context, attempts int) {
+	if attempts > 0 {
+		c.Header("X-DeepLX-Attempts", strconv.Itoa(attempts))
+	}
 }
+
 func writeSSE(c *gin.Context, data interface{}) error {
-    jsonData, err := json.Marshal(data)
-    if err != nil {
-        return err
-    }
-    _, err = c.Writer.Write([]byte("data: " + string(jsonData) + "\n\n"))
-    if err != nil {
-        return err
-    }
-    c.Writer.Flush()
-    return nil
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.Write([]byte("data: " + string(jsonData) + "\n\n"))
+	if err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
 }
 
-func main() {
-	cfg := initConfig()
+// chatChoices returns the contents of up to n choices, the translation followed by its alternatives
+func chatChoices(result translate.DeepLXTranslationResult, n int, md *markdownText) []string {
+	contents := append([]string{result.Data}, result.Alternatives...)
+	if len(contents) > n {
+		contents = contents[:n]
+	}
+	if md != nil {
+		for i, content := range contents {
+			contents[i] = md.restore(content)
+		}
+	}
+	return contents
+}
 
-	fmt.Printf("DeepL X has been successfully launched! Listening on %v:%v\n", cfg.IP, cfg.Port)
-	fmt.Println("Developed by sjlleo <i@leo.moe> and missuo <me@missuo.me>.")
+// maxImportSize bounds the body of a TMX import
+var maxImportSize int64 = 64 << 20
 
-	// Set Proxy
-	proxyURL := os.Getenv("PROXY")
-	if proxyURL == "" {
-		proxyURL = cfg.Proxy
+// translatePayload answers /translate and /v1/translate, which differ only in the web client.
+// webClient picks it for the bound payload, or answers the request itself and returns false.
+func translatePayload(c *gin.Context, cfg *Config, providers map[string]translate.Translator, webClient func(req PayloadPro) (translate.Translator, bool)) {
+	req := PayloadPro{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "Invalid request payload",
+		})
+		return
+	}
+
+	if req.TagHandling != "" && req.TagHandling != "html" && req.TagHandling != "xml" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "Invalid tag_handling value. Allowed values are 'html' and 'xml'.",
+		})
+		return
 	}
-	if proxyURL != "" {
-		proxy, err := url.Parse(proxyURL)
+
+	detectMode, err := translate.ParseDetectMode(req.DetectMode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "Invalid detect_mode value. Allowed values are 'deepl', 'once' and 'segment'.",
+		})
+		return
+	}
+
+	web, ok := webClient(req)
+	if !ok {
+		return
+	}
+	provider, err := selectProvider(cfg, providers, web, req.Provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	result, err := provider.TranslateContext(c.Request.Context(), translate.Request{
+		SourceLang:  req.SourceLang,
+		TargetLang:  req.TargetLang,
+		Text:        req.TransText,
+		TagHandling: req.TagHandling,
+		DetectMode:  detectMode,
+		NoCache:     noCache(c, req.NoCache),
+	})
+	if err != nil {
+		status := errorStatus(err)
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": fmt.Sprintf("Translation failed: %v", err),
+		})
+		return
+	}
+
+	setCacheHeader(c, result.CacheHits, result.CacheMisses)
+	setAttemptsHeader(c, result.Attempts)
+	c.JSON(http.StatusOK, result)
+}
+
+// isProSession reports whether a dl_session belongs to a Pro account, free account sessions contain a dot
+func isProSession(session string) bool {
+	return !strings.Contains(session, ".")
+}
+
+// sseKeepAlive is how often a comment is written while a stream waits on upstream,
+// so that proxies and clients do not give up on a silent connection
+var sseKeepAlive = 15 * time.Second
+
+// streamCompletion answers a chat completion with server-sent events, one chunk per piece of
+// the translation emitted by provider. Errors are answered as JSON until the stream has started,
+// afterwards as an error event. The syntax of md, if any, is put back into the translation.
+func streamCompletion(c *gin.Context, provider translate.Translator, r translate.Request, model string, n int, md *markdownText) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	// The writer is only used by this goroutine, the translation hands its pieces over
+	deltas := make(chan string)
+	done := make(chan error, 1)
+	var result translate.DeepLXTranslationResult
+	go func() {
+		emit := func(delta string) error {
+			select {
+			case deltas <- delta:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if md != nil {
+			emit = md.stream(emit)
+		}
+		var err error
+		result, err = translate.TranslateStream(ctx, provider, r, emit)
+		done <- err
+	}()
+
+	chunk := ChatCompletionChunk{
+		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []ChunkChoice{{Index: 0}},
+	}
+	started := false
+	start := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("Transfer-Encoding", "chunked")
+
+		// 发送角色信息
+		chunk.Choices[0].Delta = DeltaStruct{Role: "assistant"}
+		return writeSSE(c, chunk)
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case delta := <-deltas:
+			// 发送翻译内容
+			if err = start(); err == nil {
+				chunk.Choices[0].Delta = DeltaStruct{Content: delta}
+				err = writeSSE(c, chunk)
+			}
+		case <-keepAlive.C:
+			if err = start(); err == nil {
+				if _, err = c.Writer.Write([]byte(": keep-alive\n\n")); err == nil {
+					c.Writer.Flush()
+				}
+			}
+		case translateErr := <-done:
+			if translateErr != nil {
+				if !started {
+					c.JSON(errorStatus(translateErr), gin.H{
+						"error": fmt.Sprintf("Translation failed: %v", translateErr),
+					})
+					return
+				}
+				if err := writeSSE(c, gin.H{"error": gin.H{"message": fmt.Sprintf("Translation failed: %v", translateErr), "type": "upstream_error"}}); err != nil {
+					log.Printf("Error writing SSE: %v", err)
+				}
+				return
+			}
+
+			// 发送完成标记
+			finishReason := "stop"
+			if err = start(); err == nil {
+				chunk.Choices[0].Delta = DeltaStruct{}
+				chunk.Choices[0].FinishReason = &finishReason
+				err = writeSSE(c, chunk)
+			}
+			// The alternatives are only known once the translation is done, each comes whole
+			for i, content := range chatChoices(result, n, md)[1:] {
+				if err != nil {
+					break
+				}
+				chunk.Choices[0] = ChunkChoice{Index: i + 1, Delta: DeltaStruct{Role: "assistant", Content: content}}
+				if err = writeSSE(c, chunk); err == nil {
+					chunk.Choices[0] = ChunkChoice{Index: i + 1, FinishReason: &finishReason}
+					err = writeSSE(c, chunk)
+				}
+			}
+			if err == nil {
+				if _, err = c.Writer.Write([]byte("data: [DONE]\n\n")); err == nil {
+					c.Writer.Flush()
+				}
+			}
+			if err != nil {
+				log.Printf("Error writing final SSE: %v", err)
+			}
+			return
+		}
 		if err != nil {
-			log.Fatalf("Failed to parse proxy URL: %v", err)
+			log.Printf("Error writing SSE: %v", err)
+			return
 		}
-		http.DefaultTransport = &http.Transport{
-			Proxy: http.ProxyURL(proxy),
+	}
+}
+
+// providerChain returns the providers of cfg.Providers in the order they are tried,
+// "deeplx" is the web client given by the handler and providers holds the others
+func providerChain(cfg *Config, providers map[string]translate.Translator, web translate.Translator) translate.Translator {
+	var chain translate.Fallback
+	for _, name := range cfg.ProviderNames() {
+		if name == providerDeepLX {
+			chain = append(chain, web)
+		} else if provider, ok := providers[name]; ok {
+			chain = append(chain, provider)
 		}
 	}
+	if len(chain) == 1 {
+		return chain[0]
+	}
+	return chain
+}
 
-	if cfg.Token != "" {
-		fmt.Println("Access token is set.")
+// selectProvider returns the provider a request asked for by name,
+// or the chain of cfg.Providers when it did not ask for one
+func selectProvider(cfg *Config, providers map[string]translate.Translator, web translate.Translator, name string) (translate.Translator, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "":
+		return providerChain(cfg, providers, web), nil
+	case providerDeepLX:
+		return web, nil
 	}
+	if provider, ok := providers[name]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("provider %q is unknown or not configured", name)
+}
 
-	// Setting the application to release mode
-	gin.SetMode(gin.ReleaseMode)
+// setupRouter registers every endpoint, handlers translate through client
+// and fall back to providers in the order of Config.Providers
+func setupRouter(cfg *Config, client *translate.Client, providers map[string]translate.Translator) *gin.Engine {
 	r := gin.Default()
 	r.Use(cors.Default())
 
+	// Invalid aliases are rejected by main before the router is set up
+	aliases, err := parseModelAliases(cfg.ModelAliases, providers)
+	if err != nil {
+		log.Printf("Ignoring model aliases: %v", err)
+	}
+
 	// Defining the root endpoint which returns the project details
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -172,162 +476,596 @@ func main() {
 		})
 	})
 
+	// The pool only serves /v1/translate when every configured session is a Pro one
+	proPool := true
+	if sessions, err := cfg.Sessions(); err == nil {
+		proPool = !slices.ContainsFunc(sessions, func(session string) bool { return !isProSession(session) })
+	}
+
 	// Free API endpoint, No Pro Account required
+	r.POST("/translate", authMiddleware(cfg), func(c *gin.Context) {
+		translatePayload(c, cfg, providers, func(PayloadPro) (translate.Translator, bool) {
+			return client, true
+		})
+	})
+
+	// Pro API endpoint, Pro Account required
+	r.POST("/v1/translate", authMiddleware(cfg), func(c *gin.Context) {
+		translatePayload(c, cfg, providers, func(req PayloadPro) (translate.Translator, bool) {
+			// The session can be supplied per request: body, then header, then config
+			dlSession := req.DlSession
+			if dlSession == "" {
+				dlSession = c.GetHeader("X-DL-Session")
+			}
+			if dlSession == "" {
+				if cookie, err := c.Cookie("dl_session"); err == nil {
+					dlSession = cookie
+				}
+			}
+			pool := client.SessionPool()
+			if dlSession == "" && pool == nil {
+				dlSession = cfg.DlSession
+			}
+
+			if dlSession == "" && pool == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"code":    http.StatusUnauthorized,
+					"message": "No dl_session Found",
+				})
+				return nil, false
+			} else if !isProSession(dlSession) || (dlSession == "" && !proPool) {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"code":    http.StatusUnauthorized,
+					"message": "Your account is not a Pro account. Please upgrade your account or switch to a different account.",
+				})
+				return nil, false
+			}
+
+			// Requests without their own session rotate across the configured ones
+			if dlSession != "" {
+				return client.Session(dlSession), true
+			}
+			return client.Pooled(), true
+		})
+	})
+
+	// Free API endpoint, Consistent with the official API format
+	r.POST("/v2/translate", authMiddleware(cfg), func(c *gin.Context) {
+		req := PayloadAPI{}
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Invalid request payload",
+			})
+			return
+		}
+
+		if len(req.Text) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Parameter 'text' not specified.",
+			})
+			return
+		}
+		if req.TargetLang == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Value for 'target_lang' not supported.",
+			})
+			return
+		}
+		if req.TagHandling != "" && req.TagHandling != "html" && req.TagHandling != "xml" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Value for 'tag_handling' not supported.",
+			})
+			return
+		}
+		detectMode, err := translate.ParseDetectMode(req.DetectMode)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Value for 'detect_mode' not supported.",
+			})
+			return
+		}
+		provider, err := selectProvider(cfg, providers, client, req.Provider)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Value for 'provider' not supported.",
+			})
+			return
+		}
+
+		// Every text is an independent segment, they are translated in parallel
+		reqs := make([]translate.Request, len(req.Text))
+		for i, text := range req.Text {
+			reqs[i] = translate.Request{
+				SourceLang:  req.SourceLang,
+				TargetLang:  req.TargetLang,
+				Text:        text,
+				TagHandling: req.TagHandling,
+				DetectMode:  detectMode,
+				NoCache:     noCache(c, req.NoCache),
+			}
+		}
+		results, err := client.TranslateBatchWith(c.Request.Context(), provider, reqs)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{
+				"message": fmt.Sprintf("Translation failed: %v", err),
+			})
+			return
+		}
+
+		// With the partial policy failed segments carry their own error
+		translations := make([]APITranslation, len(results))
+		var firstErr error
+		var cacheHits, cacheMisses, attempts int
+		for i, result := range results {
+			cacheHits += result.CacheHits
+			cacheMisses += result.CacheMisses
+			attempts += result.Attempts
+			if result.Err != nil {
+				if firstErr == nil {
+					firstErr = result.Err
+				}
+				translations[i].Error = result.Err.Error()
+				continue
+			}
+			translations[i] = APITranslation{
+				DetectedSourceLanguage: strings.ToUpper(result.SourceLang),
+				Text:                   result.Data,
+			}
+		}
+		if firstErr != nil && len(results) == 1 {
+			c.JSON(errorStatus(firstErr), gin.H{
+				"message": fmt.Sprintf("Translation failed: %v", firstErr),
+			})
+			return
+		}
+
+		setCacheHeader(c, cacheHits, cacheMisses)
+		setAttemptsHeader(c, attempts)
+		c.JSON(http.StatusOK, gin.H{
+			"translations": translations,
+		})
+	})
+
+	// OpenAI compatible endpoint
 	r.POST("/v1/chat/completions", authMiddleware(cfg), func(c *gin.Context) {
-    var req ChatCompletionRequest
-    if err := c.BindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error": "Invalid request format",
-        })
-        return
-    }
-
-    if len(req.Messages) == 0 {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error": "No messages provided",
-        })
-        return
-    }
-    
-    lastMessage := req.Messages[len(req.Messages)-1].Content
-    sourceLang := ""
-    targetLang := ""
-
-    // 根据model名称决定翻译方向
-    switch req.Model {
-    case "deepl-zh-en":
-        sourceLang = "ZH"
-        targetLang = "EN"
-    case "deepl-en-zh":
-        sourceLang = "EN"
-        targetLang = "ZH"
-    case "deepl-auto-zh":
-        sourceLang = ""
-        targetLang = "ZH"
-    case "deepl-auto-en":
-        sourceLang = ""
-        targetLang = "EN"
-    default:
-        sourceLang = ""
-        targetLang = "ZH"
-    }
-
-    if strings.HasPrefix(lastMessage, "Translate to ") {
-        parts := strings.SplitN(lastMessage, ":", 2)
-        if len(parts) == 2 {
-            targetLang = strings.TrimSpace(strings.TrimPrefix(parts[0], "Translate to "))
-            lastMessage = strings.TrimSpace(parts[1])
-        }
-    }
-
-    result, err := translate.TranslateByDeepLX(sourceLang, targetLang, lastMessage, "", cfg.Proxy, cfg.DlSession)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": fmt.Sprintf("Translation failed: %v", err),
-        })
-        return
-    }
-
-    if result.Code != http.StatusOK {
-        c.JSON(result.Code, gin.H{
-            "error": result.Message,
-        })
-        return
-    }
-
-    // 判断是否为流式请求
-    if req.Stream {
-        // 流式响应
-        c.Header("Content-Type", "text/event-stream")
-        c.Header("Cache-Control", "no-cache")
-        c.Header("Connection", "keep-alive")
-        c.Header("Transfer-Encoding", "chunked")
-
-        // 发送角色信息
-  chunk := ChatCompletionChunk{
-    ID:      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
-    Object:  "chat.completion.chunk",
-    Created: time.Now().Unix(),
-    Model:   req.Model,
-    Choices: []ChunkChoice{{
-        Index: 0,
-        Delta: DeltaStruct{
-            Role: "assistant",
-        },
-        FinishReason: nil,
-    }},
+		var req ChatCompletionRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request format",
+			})
+			return
+		}
+
+		if len(req.Messages) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "No messages provided",
+			})
+			return
+		}
+
+		n := req.N
+		if n == 0 {
+			n = 1
+		}
+		if n < 1 || n > maxChatChoices {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("n must be between 1 and %d", maxChatChoices),
+			})
+			return
+		}
+
+		// 根据model名称决定翻译方向
+		model, ok := resolveChatModel(req.Model, aliases, providers)
+		if !ok {
+			modelNotFound(c, req.Model)
+			return
+		}
+		// The last message is translated, system messages carry instructions
+		// and the earlier turns of the conversation are given as context
+		var system, history []string
+		for _, message := range req.Messages[:len(req.Messages)-1] {
+			switch message.Role {
+			case "system", "developer":
+				system = append(system, string(message.Content))
+			case "user", "assistant":
+				history = append(history, string(message.Content))
+			}
+		}
+		instr := parseInstructions(strings.Join(system, "\n"))
+		lastMessage := string(req.Messages[len(req.Messages)-1].Content)
+		sourceLang := model.sourceLang
+		targetLang := model.targetLang
+		formality := model.formality
+		if instr.sourceLang != "" {
+			sourceLang = instr.sourceLang
+		}
+		if instr.targetLang != "" {
+			targetLang = instr.targetLang
+		}
+		if instr.formality != "" {
+			formality = instr.formality
+		}
+
+		if strings.HasPrefix(lastMessage, "Translate to ") {
+			parts := strings.SplitN(lastMessage, ":", 2)
+			if len(parts) == 2 {
+				targetLang = strings.TrimSpace(strings.TrimPrefix(parts[0], "Translate to "))
+				if code, ok := lookupLanguageName(targetLang); ok {
+					targetLang = code
+				}
+				lastMessage = strings.TrimSpace(parts[1])
+			}
+		}
+
+		text := lastMessage
+		var md *markdownText
+		if instr.keepMarkdown {
+			md = newMarkdownText(lastMessage)
+			text = md.text
+		}
+
+		web := client.Pooled()
+		if web == nil {
+			web = client.Session(cfg.DlSession)
+		}
+		provider, err := selectProvider(cfg, providers, web, model.provider)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		tr := translate.Request{
+			SourceLang: sourceLang,
+			TargetLang: targetLang,
+			Text:       text,
+			Formality:  formality,
+			Context:    strings.Join(history, "\n"),
+			Glossary:   instr.glossary,
+			Beams:      n,
+			NoCache:    noCache(c, false),
+		}
+
+		// 判断是否为流式请求
+		if req.Stream {
+			streamCompletion(c, provider, tr, req.Model, n, md)
+			return
+		}
+
+		result, err := provider.TranslateContext(c.Request.Context(), tr)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{
+				"error": fmt.Sprintf("Translation failed: %v", err),
+			})
+			return
+		}
+
+		setCacheHeader(c, result.CacheHits, result.CacheMisses)
+		setAttemptsHeader(c, result.Attempts)
+
+		// 非流式响应
+		response := ChatCompletionResponse{
+			ID:      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   req.Model,
+		}
+		completionTokens := 0
+		for i, content := range chatChoices(result, n, md) {
+			choice := ChatChoice{Index: i, FinishReason: "stop"}
+			choice.Message.Role = "assistant"
+			choice.Message.Content = content
+			response.Choices = append(response.Choices, choice)
+			completionTokens += len(content)
+		}
+		response.Usage.PromptTokens = len(lastMessage)
+		response.Usage.CompletionTokens = completionTokens
+		response.Usage.TotalTokens = len(lastMessage) + completionTokens
+
+		c.JSON(http.StatusOK, response)
+	})
+
+	// OpenAI compatible model listing, one model per translation direction
+	r.GET("/v1/models", authMiddleware(cfg), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"object": "list",
+			"data":   append(append([]Model(nil), aliases...), chatModels()...),
+		})
+	})
+
+	r.GET("/v1/models/:model", authMiddleware(cfg), func(c *gin.Context) {
+		model, ok := resolveChatModel(c.Param("model"), aliases, providers)
+		if !ok {
+			modelNotFound(c, c.Param("model"))
+			return
+		}
+		c.JSON(http.StatusOK, model)
+	})
+
+	// The admin endpoints expose and rewrite what every user is served,
+	// without an access token they are not registered at all
+	if cfg.Token == "" {
+		return r
+	}
+	admin := r.Group("/admin", authMiddleware(cfg))
+
+	// Upstream identities whose circuit breaker recorded failures
+	admin.GET("/circuits", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"circuits": client.CircuitStates(),
+		})
+	})
+
+	// State of the pooled proxies
+	if pool := client.ProxyPool(); pool != nil {
+		admin.GET("/proxies", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"proxies": pool.States(),
+			})
+		})
+	}
+
+	// State of the pooled sessions
+	if pool := client.SessionPool(); pool != nil {
+		admin.GET("/sessions", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"sessions": pool.States(),
+			})
+		})
+	}
+
+	// Translation memory export and import as TMX
+	if tm := client.TranslationMemory(); tm != nil {
+		admin.GET("/tm/export", func(c *gin.Context) {
+			c.Header("Content-Type", "application/x-tmx+xml; charset=utf-8")
+			c.Header("Content-Disposition", `attachment; filename="deeplx.tmx"`)
+			c.Status(http.StatusOK)
+			if err := tm.ExportTMX(c.Writer); err != nil {
+				log.Printf("Error exporting translation memory: %v", err)
+			}
+		})
+
+		admin.POST("/tm/import", func(c *gin.Context) {
+			n, err := tm.ImportTMX(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+			if err != nil {
+				status := http.StatusBadRequest
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					status = http.StatusRequestEntityTooLarge
+				}
+				c.JSON(status, gin.H{
+					"code":    status,
+					"message": err.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"code":     http.StatusOK,
+				"imported": n,
+			})
+		})
+	}
+
+	return r
 }
 
+// retryOptions parses a retry spec such as "3" or "3,LMT_split_text=2": the number of attempts
+// of every JSON-RPC method followed by the methods that differ. delay is the first backoff.
+func retryOptions(spec string, delay time.Duration) ([]translate.Option, error) {
+	policy := translate.DefaultRetryPolicy
+	if delay > 0 {
+		policy.BaseDelay = delay
+		policy.MaxDelay = max(policy.MaxDelay, delay)
+	}
 
-        if err := writeSSE(c, chunk); err != nil {
-            log.Printf("Error writing SSE: %v", err)
-            return
-        }
-
-        // 发送翻译内容
-        chunk.Choices[0].Delta.Role = ""
-        chunk.Choices[0].Delta.Content = result.Data
-        if err := writeSSE(c, chunk); err != nil {
-            log.Printf("Error writing SSE: %v", err)
-            return
-        }
-
-        // 发送完成标记
-        finishReason := "stop"
-        chunk.Choices[0].Delta.Content = ""
-        chunk.Choices[0].FinishReason = &finishReason
-        if err := writeSSE(c, chunk); err != nil {
-            log.Printf("Error writing SSE: %v", err)
-            return
-        }
-
-        if _, err := c.Writer.Write([]byte("data: [DONE]\n\n")); err != nil {
-            log.Printf("Error writing final SSE: %v", err)
-        }
-        c.Writer.Flush()
-    } else {
-        // 非流式响应
-        response := ChatCompletionResponse{
-            ID:      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
-            Object:  "chat.completion",
-            Created: time.Now().Unix(),
-            Model:   req.Model,
-            Choices: []struct {
-                Index        int `json:"index"`
-                Message     struct {
-                    Role    string `json:"role"`
-                    Content string `json:"content"`
-                } `json:"message"`
-                FinishReason string `json:"finish_reason"`
-            }{
-                {
-                    Index: 0,
-                    Message: struct {
-                        Role    string `json:"role"`
-                        Content string `json:"content"`
-                    }{
-                        Role:    "assistant",
-                        Content: result.Data,
-                    },
-                    FinishReason: "stop",
-                },
-            },
-            Usage: struct {
-                PromptTokens     int `json:"prompt_tokens"`
-                CompletionTokens int `json:"completion_tokens"`
-                TotalTokens      int `json:"total_tokens"`
-            }{
-                PromptTokens:     len(lastMessage),
-                CompletionTokens: len(result.Data),
-                TotalTokens:      len(lastMessage) + len(result.Data),
-            },
-        }
-
-        c.JSON(http.StatusOK, response)
-    }
-})
+	opts := []translate.Option{translate.WithRetryPolicy(policy)}
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		method, value, perMethod := strings.Cut(part, "=")
+		if !perMethod {
+			value = method
+		}
+		attempts, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || attempts < 1 {
+			return nil, fmt.Errorf("invalid number of attempts %q", value)
+		}
+		methodPolicy := policy
+		methodPolicy.MaxAttempts = attempts
+		if perMethod {
+			opts = append(opts, translate.WithMethodRetryPolicy(strings.TrimSpace(method), methodPolicy))
+		} else {
+			policy = methodPolicy
+			opts[0] = translate.WithRetryPolicy(policy)
+		}
+	}
+	return opts, nil
+}
+
+// newProviders registers the providers other than the web client by name. Google Translate web
+// needs no configuration so it is only registered when listed in Providers, the others
+// are registered once their endpoint or key is set.
+func newProviders(cfg *Config, proxy string) (map[string]translate.Translator, error) {
+	providers := map[string]translate.Translator{}
+	if cfg.DeepLAPIKey != "" {
+		official, err := translate.NewOfficialClient(cfg.DeepLAPIKey,
+			translate.WithProviderBaseURL(cfg.DeepLAPIURL),
+			translate.WithProviderProxy(proxy))
+		if err != nil {
+			return nil, fmt.Errorf("DeepL API: %w", err)
+		}
+		providers[providerOfficial] = official
+	}
+	if cfg.LibreURL != "" {
+		libre, err := translate.NewLibreClient(cfg.LibreURL, cfg.LibreAPIKey, translate.WithProviderProxy(proxy))
+		if err != nil {
+			return nil, fmt.Errorf("LibreTranslate: %w", err)
+		}
+		providers[providerLibre] = libre
+	}
+	if slices.Contains(cfg.ProviderNames(), providerGoogle) {
+		google, err := translate.NewGoogleClient(translate.WithProviderProxy(proxy))
+		if err != nil {
+			return nil, fmt.Errorf("Google Translate: %w", err)
+		}
+		providers[providerGoogle] = google
+	}
+	if cfg.LLMURL != "" {
+		llm, err := translate.NewLLMClient(cfg.LLMURL, cfg.LLMAPIKey, cfg.LLMModel, translate.WithProviderProxy(proxy))
+		if err != nil {
+			return nil, fmt.Errorf("LLM: %w", err)
+		}
+		providers[providerLLM] = llm
+	}
+	return providers, nil
+}
+
+// firstProxy returns the proxy used by providers that do not rotate proxies
+func firstProxy(proxies []string) string {
+	if len(proxies) == 0 {
+		return ""
+	}
+	return proxies[0]
+}
+
+func main() {
+	cfg := initConfig()
+
+	fmt.Printf("DeepL X has been successfully launched! Listening on %v:%v\n", cfg.IP, cfg.Port)
+	fmt.Println("Developed by sjlleo <i@leo.moe> and missuo <me@missuo.me>.")
+
+	// Set Proxy
+	if proxyURL := os.Getenv("PROXY"); proxyURL != "" {
+		cfg.Proxy = proxyURL
+	}
+	proxies := cfg.Proxies()
+	if len(proxies) == 1 {
+		proxy, err := url.Parse(proxies[0])
+		if err != nil {
+			log.Fatalf("Failed to parse proxy URL: %v", err)
+		}
+		http.DefaultTransport = &http.Transport{
+			Proxy: http.ProxyURL(proxy),
+		}
+	}
+
+	if cfg.Token != "" {
+		fmt.Println("Access token is set.")
+	} else {
+		fmt.Println("No access token is set, the /admin endpoints are disabled.")
+	}
 
+	// A single client is shared by all handlers so upstream connections are reused
+	batchPolicy, err := translate.ParseBatchPolicy(cfg.BatchPolicy)
+	if err != nil {
+		log.Fatalf("Invalid batch policy: %v", err)
+	}
+	detectMode, err := translate.ParseDetectMode(cfg.DetectMode)
+	if err != nil {
+		log.Fatalf("Invalid detect mode: %v", err)
+	}
+	// The local cache answers first, a Redis cache is shared by every instance
+	var caches translate.TieredCache
+	if cfg.CacheSize > 0 {
+		caches = append(caches, translate.NewMemoryCache(cfg.CacheSize, cfg.CacheTTL))
+	}
+	if cfg.RedisURL != "" {
+		redisCache, err := translate.NewRedisCache(cfg.RedisURL, cfg.CacheTTL)
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		defer redisCache.Close()
+		caches = append(caches, redisCache)
+	}
+	var cache translate.Cache
+	switch len(caches) {
+	case 0:
+	case 1:
+		cache = caches[0]
+	default:
+		cache = caches
+	}
+	var tm *translate.TranslationMemory
+	if cfg.TMPath != "" {
+		tm, err = translate.OpenTranslationMemory(cfg.TMPath)
+		if err != nil {
+			log.Fatalf("Failed to open translation memory: %v", err)
+		}
+		defer tm.Close()
+	}
+	sessions, err := cfg.Sessions()
+	if err != nil {
+		log.Fatalf("Failed to load sessions: %v", err)
+	}
+	var pool *translate.SessionPool
+	if len(sessions) > 0 {
+		for _, session := range sessions {
+			if !isProSession(session) {
+				log.Printf("Warning: dl_session %s is not a Pro account session, /v1/translate will refuse to use it", translate.MaskSession(session))
+			}
+		}
+		strategy, err := translate.ParseRotationStrategy(cfg.SessionStrategy)
+		if err != nil {
+			log.Fatalf("Invalid session strategy: %v", err)
+		}
+		pool, err = translate.NewSessionPool(sessions, strategy, cfg.SessionCooldown)
+		if err != nil {
+			log.Fatalf("Failed to create session pool: %v", err)
+		}
+		fmt.Printf("Rotating across %d dl_session(s).\n", len(sessions))
+	}
+	// Several proxies are rotated, a single one is used for every request
+	proxyOpt := translate.WithProxyPool(nil)
+	switch {
+	case len(proxies) == 1:
+		proxyOpt = translate.WithProxy(proxies[0])
+	case len(proxies) > 1:
+		strategy, err := translate.ParseRotationStrategy(cfg.ProxyStrategy)
+		if err != nil {
+			log.Fatalf("Invalid proxy strategy: %v", err)
+		}
+		proxyPool, err := translate.NewProxyPool(proxies, strategy, cfg.ProxyEjection)
+		if err != nil {
+			log.Fatalf("Failed to create proxy pool: %v", err)
+		}
+		proxyOpt = translate.WithProxyPool(proxyPool)
+		fmt.Printf("Rotating across %d proxies.\n", len(proxies))
+	}
+	retryOpts, err := retryOptions(cfg.Retries, cfg.RetryDelay)
+	if err != nil {
+		log.Fatalf("Invalid retry policy: %v", err)
+	}
+	client, err := translate.NewClient(append([]translate.Option{
+		proxyOpt,
+		translate.WithSessionPool(pool),
+		translate.WithCache(cache),
+		translate.WithTranslationMemory(tm),
+		translate.WithDetectMode(detectMode),
+		translate.WithConcurrency(cfg.Concurrency),
+		translate.WithBatchPolicy(batchPolicy),
+		translate.WithCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}, retryOpts...)...)
+	if err != nil {
+		log.Fatalf("Failed to create translate client: %v", err)
+	}
+
+	providers, err := newProviders(cfg, firstProxy(proxies))
+	if err != nil {
+		log.Fatalf("Failed to create translation providers: %v", err)
+	}
+	for _, name := range cfg.ProviderNames() {
+		if _, ok := providers[name]; !ok && name != providerDeepLX {
+			log.Fatalf("Provider %q is unknown or not configured", name)
+		}
+	}
+	if _, err := parseModelAliases(cfg.ModelAliases, providers); err != nil {
+		log.Fatalf("Invalid model aliases: %v", err)
+	}
 
+	// Setting the application to release mode
+	gin.SetMode(gin.ReleaseMode)
+	r := setupRouter(cfg, client, providers)
 
 	r.Run(fmt.Sprintf("%v:%v", cfg.IP, cfg.Port))
 }
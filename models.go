@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	translate "github.com/OwO-Network/DeepLX/translate"
+	"github.com/gin-gonic/gin"
+)
+
+// modelsCreated is reported as the creation time of every model, clients only display it
+const modelsCreated = 1692835200
+
+// Model is an entry of GET /v1/models, it stands for a translation direction
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+
+	provider   string // registered provider, empty for the chain of Config.Providers
+	sourceLang string // empty when the language is detected
+	targetLang string
+	formality  translate.Formality
+}
+
+// chatModels lists a deepl model for every supported direction, named deepl-<source|auto>-<target>
+// in lower case. Translating a language into itself is only listed for regional variants.
+var chatModels = sync.OnceValue(func() []Model {
+	languages := translate.Languages()
+	sources := []string{"auto"}
+	for _, lang := range languages {
+		if lang.Source {
+			sources = append(sources, lang.Code)
+		}
+	}
+
+	var models []Model
+	for _, source := range sources {
+		for _, target := range languages {
+			if model, ok := parseChatModel("deepl-"+source+"-"+target.Code, nil); ok {
+				models = append(models, model)
+			}
+		}
+	}
+	return models
+})
+
+// parseChatModel parses a model named <engine>-<source|auto>-<target>[-<variant>]. The engine is
+// deepl for the chain of Config.Providers, or the name of a provider to use it alone.
+func parseChatModel(id string, providers map[string]translate.Translator) (Model, bool) {
+	parts := strings.Split(strings.ToLower(id), "-")
+	if len(parts) < 3 {
+		return Model{}, false
+	}
+	engine, source, target := parts[0], parts[1], strings.Join(parts[2:], "-")
+
+	model := Model{ID: strings.ToLower(id), Object: "model", Created: modelsCreated, OwnedBy: "deeplx"}
+	if engine != "deepl" {
+		if _, ok := providers[engine]; !ok && engine != providerDeepLX {
+			return Model{}, false
+		}
+		model.provider = engine
+	}
+	if source != "auto" {
+		lang, ok := translate.LookupLanguage(source)
+		if !ok || !lang.Source {
+			return Model{}, false
+		}
+		model.sourceLang = lang.Code
+	}
+	lang, ok := translate.LookupLanguage(target)
+	if !ok || lang.Code == model.sourceLang {
+		return Model{}, false
+	}
+	model.targetLang = lang.Code
+	return model, true
+}
+
+// parseModelAliases parses operator defined models such as "translator-jp=deepl-auto-ja:formal,...":
+// the alias, the model it stands for and optionally a formality
+func parseModelAliases(spec string, providers map[string]translate.Translator) ([]Model, error) {
+	var aliases []Model
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, target, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid model alias %q, want name=model[:formality]", part)
+		}
+		target, formality, _ := strings.Cut(strings.TrimSpace(target), ":")
+		model, ok := parseChatModel(target, providers)
+		if !ok {
+			return nil, fmt.Errorf("model alias %q: unknown model %q", name, target)
+		}
+		var err error
+		if model.formality, err = translate.ParseFormality(formality); err != nil {
+			return nil, fmt.Errorf("model alias %q: %w", name, err)
+		}
+		model.ID = name
+		aliases = append(aliases, model)
+	}
+	return aliases, nil
+}
+
+// resolveChatModel returns the alias named id, or the model id stands for
+func resolveChatModel(id string, aliases []Model, providers map[string]translate.Translator) (Model, bool) {
+	for _, alias := range aliases {
+		if strings.EqualFold(alias.ID, id) {
+			return alias, true
+		}
+	}
+	return parseChatModel(id, providers)
+}
+
+// modelNotFound answers like the OpenAI API does for an unknown model
+func modelNotFound(c *gin.Context, id string) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"message": fmt.Sprintf("The model `%s` does not exist", id),
+			"type":    "invalid_request_error",
+			"param":   "model",
+			"code":    "model_not_found",
+		},
+	})
+}
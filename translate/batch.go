@@ -0,0 +1,158 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	// defaultConcurrency is the number of upstream requests run in parallel
+	defaultConcurrency = 4
+	// defaultMaxChars is the largest amount of text sent in a single LMT_handle_jobs request
+	defaultMaxChars = 5000
+)
+
+// BatchPolicy decides what TranslateBatch does when a segment fails
+type BatchPolicy int
+
+const (
+	// FailFast cancels the remaining segments and returns the first error
+	FailFast BatchPolicy = iota
+	// Partial translates every segment and reports failures per segment
+	Partial
+)
+
+// ParseBatchPolicy parses "fail-fast" or "partial", an empty string means FailFast
+func ParseBatchPolicy(s string) (BatchPolicy, error) {
+	switch s {
+	case "", "fail-fast":
+		return FailFast, nil
+	case "partial":
+		return Partial, nil
+	}
+	return FailFast, fmt.Errorf("unknown batch policy %q, want fail-fast or partial", s)
+}
+
+// BatchResult is the outcome of a single segment of TranslateBatch
+type BatchResult struct {
+	DeepLXTranslationResult
+	Err error
+}
+
+// TranslateBatch translates independent segments on at most WithConcurrency workers.
+// Results are in the order of reqs. With FailFast the first error is returned,
+// with Partial the error is only non-nil when ctx is done and failures are reported in BatchResult.Err.
+func (c *Client) TranslateBatch(ctx context.Context, reqs []Request) ([]BatchResult, error) {
+	return c.TranslateBatchWith(ctx, c, reqs)
+}
+
+// TranslateBatchWith is like TranslateBatch but translates every segment with t,
+// for example a Fallback that starts with c
+func (c *Client) TranslateBatchWith(ctx context.Context, t Translator, reqs []Request) ([]BatchResult, error) {
+	results := make([]BatchResult, len(reqs))
+	failFast := c.batchPolicy == FailFast
+	errs := forEach(ctx, len(reqs), c.concurrency, failFast, func(ctx context.Context, i int) error {
+		result, err := t.TranslateContext(ctx, reqs[i])
+		results[i] = BatchResult{DeepLXTranslationResult: result, Err: err}
+		return err
+	})
+
+	if failFast {
+		if err := firstError(errs); err != nil {
+			return results, err
+		}
+	}
+	return results, ctx.Err()
+}
+
+// forEach calls fn for every index in [0, n) on at most limit goroutines.
+// With failFast the context given to fn is cancelled after the first failure and
+// the indexes that were not started yet fail with that error.
+func forEach(ctx context.Context, n, limit int, failFast bool, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	if n == 1 {
+		errs[0] = fn(ctx, 0)
+		return errs
+	}
+	if limit <= 0 {
+		limit = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			// Either the caller gave up or a segment failed in fail fast mode
+			mu.Lock()
+			err := firstErr
+			mu.Unlock()
+			if err == nil {
+				err = ctx.Err()
+			}
+			errs[i] = err
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(ctx, i)
+			if errs[i] != nil && failFast {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = errs[i]
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// firstError returns the error that is not merely a consequence of another segment failing
+func firstError(errs []error) error {
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// batchLines groups consecutive lines into batches of at most maxChars characters,
+// a line longer than maxChars gets a batch of its own. Batches are [start, end) ranges.
+func batchLines(texts []string, maxChars int) [][2]int {
+	var batches [][2]int
+	start, size := 0, 0
+	for i, text := range texts {
+		if i > start && maxChars > 0 && size+len(text) > maxChars {
+			batches = append(batches, [2]int{start, i})
+			start, size = i, 0
+		}
+		size += len(text)
+	}
+	return append(batches, [2]int{start, len(texts)})
+}
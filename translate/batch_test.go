@@ -0,0 +1,111 @@
+package translate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OwO-Network/DeepLX/translate"
+	"github.com/OwO-Network/DeepLX/translate/deepltest"
+)
+
+func TestTranslateBatch(t *testing.T) {
+	client, server := newTestClient(t, translate.WithConcurrency(3))
+
+	var reqs []translate.Request
+	for i := 0; i < 10; i++ {
+		reqs = append(reqs, translate.Request{SourceLang: "EN", TargetLang: "DE", Text: fmt.Sprintf("Text %d", i)})
+	}
+	results, err := client.TranslateBatch(context.Background(), reqs)
+	if err != nil {
+		t.Fatalf("TranslateBatch: %v", err)
+	}
+	for i, result := range results {
+		if want := fmt.Sprintf("[DE] Text %d", i); result.Err != nil || result.Data != want {
+			t.Errorf("results[%d] = %q, %v, want %q", i, result.Data, result.Err, want)
+		}
+	}
+	if n := server.CallCount("LMT_handle_jobs"); n != 10 {
+		t.Errorf("LMT_handle_jobs calls = %d, want 10", n)
+	}
+}
+
+func TestTranslateBatchConcurrency(t *testing.T) {
+	client, server := newTestClient(t, translate.WithConcurrency(2), translate.WithMaxChars(20))
+	var inFlight, peak atomic.Int32
+	server.SetTranslateFunc(func(text, sourceLang, targetLang string, beam int) string {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return deepltest.DefaultTranslate(text, sourceLang, targetLang, beam)
+	})
+
+	// Every segment is cut into batches, which must not multiply the limit
+	var reqs []translate.Request
+	for i := 0; i < 4; i++ {
+		text := fmt.Sprintf("First line %d\nSecond line %d\nThird line %d", i, i, i)
+		reqs = append(reqs, translate.Request{SourceLang: "EN", TargetLang: "DE", Text: text})
+	}
+	if _, err := client.TranslateBatch(context.Background(), reqs); err != nil {
+		t.Fatalf("TranslateBatch: %v", err)
+	}
+	if n := server.CallCount("LMT_handle_jobs"); n != 12 {
+		t.Errorf("LMT_handle_jobs calls = %d, want 12", n)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d upstream requests in flight, want at most 2", p)
+	}
+}
+
+func TestTranslateBatchPolicy(t *testing.T) {
+	reqs := []translate.Request{
+		{SourceLang: "EN", TargetLang: "DE", Text: "One"},
+		{SourceLang: "EN", TargetLang: "DE", Text: "Two"},
+	}
+
+	client, server := newTestClient(t, translate.WithConcurrency(1), noRetry)
+	server.FailNext("LMT_handle_jobs", deepltest.RateLimited)
+	if _, err := client.TranslateBatch(context.Background(), reqs); !errors.Is(err, translate.ErrRateLimited) {
+		t.Errorf("fail fast: err = %v, want ErrRateLimited", err)
+	}
+
+	client, server = newTestClient(t, translate.WithConcurrency(1), translate.WithBatchPolicy(translate.Partial), noRetry)
+	server.FailNext("LMT_handle_jobs", deepltest.RateLimited)
+	results, err := client.TranslateBatch(context.Background(), reqs)
+	if err != nil {
+		t.Fatalf("partial: err = %v", err)
+	}
+	if !errors.Is(results[0].Err, translate.ErrRateLimited) {
+		t.Errorf("results[0].Err = %v, want ErrRateLimited", results[0].Err)
+	}
+	if results[1].Err != nil || results[1].Data != "[DE] Two" {
+		t.Errorf("results[1] = %q, %v", results[1].Data, results[1].Err)
+	}
+}
+
+func TestTranslateLongDocument(t *testing.T) {
+	client, server := newTestClient(t, translate.WithMaxChars(20))
+
+	lines := []string{"First line here", "Second line here", "", "Third line here"}
+	result, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: strings.Join(lines, "\n")})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	want := "[DE] First line here\n[DE] Second line here\n\n[DE] Third line here"
+	if result.Data != want {
+		t.Errorf("Data = %q, want %q", result.Data, want)
+	}
+	if n := server.CallCount("LMT_handle_jobs"); n != 3 {
+		t.Errorf("LMT_handle_jobs calls = %d, want 3", n)
+	}
+}
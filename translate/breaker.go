@@ -0,0 +1,175 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBreakerThreshold is the number of consecutive upstream failures that open a circuit
+	defaultBreakerThreshold = 5
+	// defaultBreakerCooldown is how long an open circuit rejects requests before probing
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// CircuitState is the state of the circuit breaker of an upstream identity
+type CircuitState string
+
+const (
+	// CircuitClosed lets requests through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects requests without calling DeepL
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe through to find out whether DeepL recovered
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakers keeps a circuit per upstream identity, i.e. per proxy and session.
+// It is safe for concurrent use.
+type breakers struct {
+	mu        sync.Mutex
+	circuits  map[breakerIdentity]*circuit
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+func newBreakers(threshold int, cooldown time.Duration) *breakers {
+	return &breakers{
+		circuits:  make(map[breakerIdentity]*circuit),
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// breakerIdentity is the route a request takes to DeepL: the proxy with its credentials
+// redacted and the whole session, so that different sessions never share a circuit
+type breakerIdentity struct {
+	proxy   string
+	session string
+}
+
+// String names the identity with its session masked
+func (id breakerIdentity) String() string {
+	name := "direct"
+	if id.proxy != "" {
+		name = id.proxy
+	}
+	if id.session != "" {
+		name += " session " + MaskSession(id.session)
+	}
+	return name
+}
+
+// circuitSeverity orders the states when masked identities collide in states
+var circuitSeverity = map[CircuitState]int{CircuitClosed: 0, CircuitHalfOpen: 1, CircuitOpen: 2}
+
+// allow reports whether a request may be made through identity, an open circuit
+// fails with ErrUpstreamUnavailable
+func (b *breakers) allow(identity breakerIdentity, method string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[identity]
+	if !ok {
+		return nil
+	}
+	switch c.state {
+	case CircuitOpen:
+		if wait := c.openedAt.Add(b.cooldown).Sub(b.now()); wait > 0 {
+			return &Error{Kind: ErrUpstreamUnavailable, Method: method, RetryAfter: wait,
+				Message: fmt.Sprintf("circuit open for %s, retry in %s", identity, wait.Round(time.Second))}
+		}
+		c.state = CircuitHalfOpen
+		c.probing = true
+	case CircuitHalfOpen:
+		if c.probing {
+			return &Error{Kind: ErrUpstreamUnavailable, Method: method,
+				Message: fmt.Sprintf("circuit half-open for %s, waiting for the probe", identity)}
+		}
+		c.probing = true
+	}
+	return nil
+}
+
+// blocked reports whether allow would reject a request through identity, without changing its circuit
+func (b *breakers) blocked(identity breakerIdentity) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[identity]
+	if !ok {
+		return false
+	}
+	switch c.state {
+	case CircuitOpen:
+		return b.now().Before(c.openedAt.Add(b.cooldown))
+	case CircuitHalfOpen:
+		return c.probing
+	}
+	return false
+}
+
+// record updates the circuit of identity with the outcome of a request
+func (b *breakers) record(identity breakerIdentity, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[identity]
+	if !ok {
+		if err == nil || !retryable(err) {
+			return
+		}
+		c = &circuit{state: CircuitClosed}
+		b.circuits[identity] = c
+	}
+	if c.state == CircuitHalfOpen {
+		c.probing = false
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// Says nothing about DeepL, a half-open circuit waits for the next probe
+	case err == nil || !retryable(err):
+		// DeepL answered, even if it did not like the request
+		delete(b.circuits, identity)
+	case c.state == CircuitHalfOpen:
+		c.state, c.openedAt = CircuitOpen, b.now()
+	default:
+		c.failures++
+		if c.failures >= b.threshold {
+			c.state, c.openedAt = CircuitOpen, b.now()
+		}
+	}
+}
+
+// states returns the circuits of the identities that failed since their last success, keyed by
+// the masked identity. Sessions that mask alike are reported with the worst of their states.
+func (b *breakers) states() map[string]CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	states := make(map[string]CircuitState, len(b.circuits))
+	for identity, c := range b.circuits {
+		state := c.state
+		if state == CircuitOpen && !b.now().Before(c.openedAt.Add(b.cooldown)) {
+			state = CircuitHalfOpen
+		}
+		name := identity.String()
+		if previous, ok := states[name]; !ok || circuitSeverity[state] > circuitSeverity[previous] {
+			states[name] = state
+		}
+	}
+	return states
+}
@@ -0,0 +1,83 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	b := newBreakers(2, time.Minute)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	rateLimited := &Error{Kind: ErrRateLimited, Method: "LMT_handle_jobs"}
+	identity := breakerIdentity{proxy: "http://proxy:8080", session: "0123456789abcdef"}
+	if identity.String() != "http://proxy:8080 session 0123****cdef" {
+		t.Errorf("identity = %q", identity)
+	}
+
+	// Requests that DeepL answers keep the circuit closed
+	b.record(identity, rateLimited)
+	b.record(identity, &Error{Kind: ErrUnsupportedLanguage, Method: "LMT_handle_jobs"})
+	b.record(identity, rateLimited)
+	if err := b.allow(identity, "LMT_handle_jobs"); err != nil {
+		t.Fatalf("closed circuit: %v", err)
+	}
+
+	b.record(identity, rateLimited)
+	err := b.allow(identity, "LMT_handle_jobs")
+	var upstreamErr *Error
+	if !errors.Is(err, ErrUpstreamUnavailable) || !errors.As(err, &upstreamErr) || upstreamErr.RetryAfter != time.Minute {
+		t.Fatalf("open circuit: err = %v", err)
+	}
+	if err := b.allow(breakerIdentity{}, "LMT_handle_jobs"); err != nil {
+		t.Errorf("other identity: %v", err)
+	}
+
+	// After the cooldown a single probe goes through, a failed probe opens the circuit again
+	now = now.Add(time.Minute)
+	if b.states()[identity.String()] != CircuitHalfOpen {
+		t.Errorf("state = %v, want half-open", b.states()[identity.String()])
+	}
+	if err := b.allow(identity, "LMT_handle_jobs"); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := b.allow(identity, "LMT_handle_jobs"); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("second request during the probe: err = %v", err)
+	}
+	b.record(identity, rateLimited)
+	if b.states()[identity.String()] != CircuitOpen {
+		t.Errorf("state = %v, want open after a failed probe", b.states()[identity.String()])
+	}
+
+	// A cancelled probe lets the next request probe, a successful one closes the circuit
+	now = now.Add(time.Minute)
+	b.allow(identity, "LMT_handle_jobs")
+	b.record(identity, context.Canceled)
+	if err := b.allow(identity, "LMT_handle_jobs"); err != nil {
+		t.Fatalf("probe after a cancelled one: %v", err)
+	}
+	b.record(identity, nil)
+	if len(b.states()) != 0 {
+		t.Errorf("states = %v, want none after recovery", b.states())
+	}
+}
+
+func TestBreakerSessionsMaskedAlike(t *testing.T) {
+	b := newBreakers(1, time.Minute)
+	rateLimited := &Error{Kind: ErrRateLimited, Method: "LMT_handle_jobs"}
+
+	// Short sessions all mask to ****, they still have circuits of their own
+	b.record(breakerIdentity{session: "abc"}, rateLimited)
+	if err := b.allow(breakerIdentity{session: "xyz"}, "LMT_handle_jobs"); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+	if err := b.allow(breakerIdentity{session: "abc"}, "LMT_handle_jobs"); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("failed session: err = %v", err)
+	}
+	b.record(breakerIdentity{session: "xyz"}, &Error{Kind: ErrUpstreamProtocol, Method: "LMT_handle_jobs", StatusCode: 502})
+	if states := b.states(); len(states) != 1 || states["direct session ****"] != CircuitOpen {
+		t.Errorf("states = %v", states)
+	}
+}
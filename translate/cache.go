@@ -0,0 +1,205 @@
+package translate
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheKey identifies the translation of a single line
+type CacheKey struct {
+	SourceLang      string // AUTO when the language is left to DeepL
+	TargetLang      string
+	TagHandling     string
+	RegionalVariant string
+	Formality       string
+	Context         string // Lines of Request.Context sent upstream
+	Beams           int    // Request.Beams when above the default
+	Text            string
+}
+
+// newCacheKey builds the key of a line, sourceLang is empty when DeepL detects it
+func newCacheKey(sourceLang, targetLang, tagHandling string, formality Formality, text string) CacheKey {
+	key := CacheKey{
+		SourceLang:  strings.ToUpper(sourceLang),
+		TargetLang:  strings.ToUpper(targetLang),
+		TagHandling: tagHandling,
+		Formality:   string(formality),
+		Text:        text,
+	}
+	if key.SourceLang == "" {
+		key.SourceLang = "AUTO"
+	}
+	if code, _, ok := strings.Cut(key.TargetLang, "-"); ok {
+		key.TargetLang = code
+		key.RegionalVariant = strings.ToUpper(targetLang)
+	}
+	return key
+}
+
+// CacheEntry is a cached line translation
+type CacheEntry struct {
+	Text         string
+	Alternatives []string
+	SourceLang   string
+}
+
+// Cache stores line translations. The lines of a request are looked up and stored together,
+// a backend that is slow gives up with ctx. Implementations must be safe for concurrent use,
+// a backend that fails should report misses rather than fail the translation.
+type Cache interface {
+	// GetMany returns the cached translation of every key, nil where it missed
+	GetMany(ctx context.Context, keys []CacheKey) []*CacheEntry
+	// SetMany stores entries[i] as the translation of keys[i]
+	SetMany(ctx context.Context, keys []CacheKey, entries []CacheEntry)
+}
+
+// TieredCache consults several caches in order, typically a local one in front of a shared one
+type TieredCache []Cache
+
+// GetMany asks each tier for the keys the previous ones missed and copies the hits into the tiers that missed
+func (t TieredCache) GetMany(ctx context.Context, keys []CacheKey) []*CacheEntry {
+	found := make([]*CacheEntry, len(keys))
+	missing := make([]int, len(keys))
+	for i := range keys {
+		missing[i] = i
+	}
+	for i, cache := range t {
+		if len(missing) == 0 {
+			break
+		}
+		missingKeys := make([]CacheKey, len(missing))
+		for j, k := range missing {
+			missingKeys[j] = keys[k]
+		}
+
+		var stillMissing []int
+		var hitKeys []CacheKey
+		var hitEntries []CacheEntry
+		for j, entry := range cache.GetMany(ctx, missingKeys) {
+			if entry == nil {
+				stillMissing = append(stillMissing, missing[j])
+				continue
+			}
+			found[missing[j]] = entry
+			hitKeys, hitEntries = append(hitKeys, missingKeys[j]), append(hitEntries, *entry)
+		}
+		if len(hitKeys) > 0 {
+			for _, missed := range t[:i] {
+				missed.SetMany(ctx, hitKeys, hitEntries)
+			}
+		}
+		missing = stillMissing
+	}
+	return found
+}
+
+// SetMany stores the translations in every tier
+func (t TieredCache) SetMany(ctx context.Context, keys []CacheKey, entries []CacheEntry) {
+	for _, cache := range t {
+		cache.SetMany(ctx, keys, entries)
+	}
+}
+
+// MemoryCache is an in-process LRU cache of line translations with a TTL.
+// It is safe for concurrent use.
+type MemoryCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[CacheKey]*list.Element
+	order *list.List // Front is the most recently used
+	now   func() time.Time
+}
+
+type memoryCacheItem struct {
+	key     CacheKey
+	entry   CacheEntry
+	expires time.Time
+}
+
+// NewMemoryCache creates a cache holding at most size lines, each for at most ttl.
+// A zero ttl keeps entries until they are evicted.
+func NewMemoryCache(size int, ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[CacheKey]*list.Element),
+		order: list.New(),
+		now:   time.Now,
+	}
+}
+
+// Get returns the cached translation of key
+func (m *MemoryCache) Get(key CacheKey) (CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.items[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	item := elem.Value.(*memoryCacheItem)
+	if !item.expires.IsZero() && m.now().After(item.expires) {
+		m.order.Remove(elem)
+		delete(m.items, key)
+		return CacheEntry{}, false
+	}
+	m.order.MoveToFront(elem)
+	return item.entry, true
+}
+
+// Set stores the translation of key, evicting the least recently used lines when full
+func (m *MemoryCache) Set(key CacheKey, entry CacheEntry) {
+	if m.size <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expires time.Time
+	if m.ttl > 0 {
+		expires = m.now().Add(m.ttl)
+	}
+	if elem, ok := m.items[key]; ok {
+		item := elem.Value.(*memoryCacheItem)
+		item.entry, item.expires = entry, expires
+		m.order.MoveToFront(elem)
+		return
+	}
+
+	m.items[key] = m.order.PushFront(&memoryCacheItem{key: key, entry: entry, expires: expires})
+	for m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+// GetMany returns the cached translation of every key, nil where it missed
+func (m *MemoryCache) GetMany(_ context.Context, keys []CacheKey) []*CacheEntry {
+	found := make([]*CacheEntry, len(keys))
+	for i, key := range keys {
+		if entry, ok := m.Get(key); ok {
+			found[i] = &entry
+		}
+	}
+	return found
+}
+
+// SetMany stores entries[i] as the translation of keys[i]
+func (m *MemoryCache) SetMany(_ context.Context, keys []CacheKey, entries []CacheEntry) {
+	for i, key := range keys {
+		m.Set(key, entries[i])
+	}
+}
+
+// Len returns the number of cached lines, including expired ones not evicted yet
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
@@ -0,0 +1,77 @@
+package translate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	cache := NewMemoryCache(2, 0)
+	a := newCacheKey("EN", "DE", "", "", "a")
+	b := newCacheKey("EN", "DE", "", "", "b")
+	c := newCacheKey("EN", "DE", "", "", "c")
+
+	cache.Set(a, CacheEntry{Text: "A"})
+	cache.Set(b, CacheEntry{Text: "B"})
+	if _, ok := cache.Get(a); !ok {
+		t.Fatal("a missing")
+	}
+	cache.Set(c, CacheEntry{Text: "C"})
+
+	if _, ok := cache.Get(b); ok {
+		t.Error("b should have been evicted as least recently used")
+	}
+	if entry, ok := cache.Get(a); !ok || entry.Text != "A" {
+		t.Errorf("a = %+v, %v", entry, ok)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len = %d, want 2", cache.Len())
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	key := newCacheKey("", "EN-GB", "html", "", "Hallo")
+	if key.SourceLang != "AUTO" || key.TargetLang != "EN" || key.RegionalVariant != "EN-GB" {
+		t.Errorf("key = %+v", key)
+	}
+	cache.Set(key, CacheEntry{Text: "Hello"})
+
+	now = now.Add(59 * time.Second)
+	if _, ok := cache.Get(key); !ok {
+		t.Error("entry expired too early")
+	}
+	now = now.Add(2 * time.Second)
+	if _, ok := cache.Get(key); ok {
+		t.Error("entry should have expired")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Len = %d, want 0", cache.Len())
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	local, shared := NewMemoryCache(10, 0), NewMemoryCache(10, 0)
+	tiered := TieredCache{local, shared}
+	key := newCacheKey("EN", "DE", "", "", "Hello")
+	local.Set(newCacheKey("EN", "DE", "", "", "Good"), CacheEntry{Text: "Gut"})
+
+	shared.Set(key, CacheEntry{Text: "Hallo"})
+	found := tiered.GetMany(context.Background(), []CacheKey{newCacheKey("EN", "DE", "", "", "Good"), key, newCacheKey("EN", "DE", "", "", "Bye")})
+	if found[0] == nil || found[0].Text != "Gut" || found[1] == nil || found[1].Text != "Hallo" || found[2] != nil {
+		t.Fatalf("GetMany = %v", found)
+	}
+	if _, ok := local.Get(key); !ok {
+		t.Error("hit in the shared tier was not copied to the local one")
+	}
+
+	other := newCacheKey("EN", "DE", "", "", "World")
+	tiered.SetMany(context.Background(), []CacheKey{other}, []CacheEntry{{Text: "Welt"}})
+	if local.Len() != 3 || shared.Len() != 2 {
+		t.Errorf("Len = %d, %d, want 3, 2", local.Len(), shared.Len())
+	}
+}
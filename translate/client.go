@@ -0,0 +1,408 @@
+package translate
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+const defaultUserAgent = "DeepLBrowserExtension/1.28.0 Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36"
+
+// Fingerprint selects the TLS ClientHello presented to DeepL
+type Fingerprint string
+
+const (
+	FingerprintRandomized Fingerprint = "randomized"
+	FingerprintChrome     Fingerprint = "chrome"
+	FingerprintFirefox    Fingerprint = "firefox"
+	FingerprintSafari     Fingerprint = "safari"
+	FingerprintEdge       Fingerprint = "edge"
+	FingerprintNone       Fingerprint = "none"
+)
+
+// Client translates through the DeepL JSON-RPC endpoint.
+// A Client is safe for concurrent use and keeps a single pooled HTTP client,
+// so connections and TLS sessions are reused between calls.
+type Client struct {
+	httpClient  *req.Client
+	headers     http.Header
+	baseURL     string
+	proxyURL    string
+	proxyName   string // proxyURL with its credentials redacted
+	dlSession   string
+	userAgent   string
+	timeout     time.Duration
+	fingerprint Fingerprint
+	concurrency int
+	slots       chan struct{} // one per upstream request in flight, shared by the clones of the Client
+	maxChars    int
+	batchPolicy BatchPolicy
+	detectMode  DetectMode
+	cache       Cache
+	memory      *TranslationMemory
+	flights     *flightGroup // nil when coalescing is disabled
+	sessions    *SessionPool
+	pooled      bool // draw a session from sessions when dlSession is empty
+	proxies     *ProxyPool
+	proxyHTTP   []*req.Client // one per proxy of proxies, so each keeps its own connections
+	retry       RetryPolicy
+	methodRetry map[string]RetryPolicy
+	breakers    *breakers // nil when the circuit breaker is disabled
+}
+
+// Option configures a Client
+type Option func(*Client) error
+
+// WithProxy routes upstream requests through the given proxy URL
+func WithProxy(proxyURL string) Option {
+	return func(c *Client) error {
+		if proxyURL == "" {
+			return nil
+		}
+		u, err := parseProxyURL(proxyURL)
+		if err != nil {
+			return err
+		}
+		c.proxyURL, c.proxyName = proxyURL, u.Redacted()
+		return nil
+	}
+}
+
+// WithProxyPool spreads upstream requests across the proxies of pool, it takes precedence over WithProxy
+func WithProxyPool(pool *ProxyPool) Option {
+	return func(c *Client) error {
+		c.proxies = pool
+		return nil
+	}
+}
+
+// WithDlSession sets the dl_session cookie used for Pro accounts
+func WithDlSession(dlSession string) Option {
+	return func(c *Client) error {
+		c.dlSession = dlSession
+		return nil
+	}
+}
+
+// WithSessionPool sets the sessions used by the clients returned by Pooled
+func WithSessionPool(pool *SessionPool) Option {
+	return func(c *Client) error {
+		c.sessions = pool
+		return nil
+	}
+}
+
+// WithRetryPolicy sets how failed upstream calls are retried, methods with a policy of their own excepted
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		c.retry = policy
+		return nil
+	}
+}
+
+// WithMethodRetryPolicy sets how failed calls of a JSON-RPC method such as LMT_handle_jobs are retried
+func WithMethodRetryPolicy(method string, policy RetryPolicy) Option {
+	return func(c *Client) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		if c.methodRetry == nil {
+			c.methodRetry = make(map[string]RetryPolicy)
+		}
+		c.methodRetry[method] = policy
+		return nil
+	}
+}
+
+// WithCircuitBreaker opens the circuit of a proxy and session after threshold consecutive
+// upstream failures, requests then fail with ErrUpstreamUnavailable until a probe made after
+// cooldown succeeds. A zero threshold disables the breaker, by default it opens after 5 failures for 30s.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *Client) error {
+		if threshold < 0 || cooldown < 0 {
+			return fmt.Errorf("invalid circuit breaker: threshold %d, cooldown %v", threshold, cooldown)
+		}
+		c.breakers = nil
+		if threshold > 0 {
+			if cooldown == 0 {
+				cooldown = defaultBreakerCooldown
+			}
+			c.breakers = newBreakers(threshold, cooldown)
+		}
+		return nil
+	}
+}
+
+// WithBaseURL overrides the DeepL JSON-RPC endpoint
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) error {
+		if _, err := url.Parse(baseURL); err != nil {
+			return fmt.Errorf("invalid base URL: %w", err)
+		}
+		c.baseURL = baseURL
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of a single upstream request
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent to DeepL
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) error {
+		c.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithFingerprint selects the TLS fingerprint mode
+func WithFingerprint(fingerprint Fingerprint) Option {
+	return func(c *Client) error {
+		switch fingerprint {
+		case FingerprintRandomized, FingerprintChrome, FingerprintFirefox,
+			FingerprintSafari, FingerprintEdge, FingerprintNone:
+			c.fingerprint = fingerprint
+			return nil
+		}
+		return fmt.Errorf("unknown TLS fingerprint %q", fingerprint)
+	}
+}
+
+// WithConcurrency bounds the number of upstream requests the Client and its
+// Session and Pooled clones have in flight at once
+func WithConcurrency(n int) Option {
+	return func(c *Client) error {
+		if n < 1 {
+			return fmt.Errorf("concurrency must be at least 1, got %d", n)
+		}
+		c.concurrency = n
+		return nil
+	}
+}
+
+// WithMaxChars caps the characters sent in a single LMT_handle_jobs request,
+// longer texts are cut at line boundaries and the parts translated in parallel
+func WithMaxChars(n int) Option {
+	return func(c *Client) error {
+		c.maxChars = n
+		return nil
+	}
+}
+
+// WithBatchPolicy sets how TranslateBatch handles a failing segment
+func WithBatchPolicy(policy BatchPolicy) Option {
+	return func(c *Client) error {
+		c.batchPolicy = policy
+		return nil
+	}
+}
+
+// WithCache stores line translations in cache and serves repeated lines from it, nil disables caching
+func WithCache(cache Cache) Option {
+	return func(c *Client) error {
+		c.cache = cache
+		return nil
+	}
+}
+
+// WithTranslationMemory persists line translations in tm, it is consulted after the cache
+func WithTranslationMemory(tm *TranslationMemory) Option {
+	return func(c *Client) error {
+		c.memory = tm
+		return nil
+	}
+}
+
+// WithDetectMode sets how the source language is detected by default, DetectPerSegment
+// unless given so that a text mixing languages is not translated as one of them
+func WithDetectMode(mode DetectMode) Option {
+	return func(c *Client) error {
+		if _, err := ParseDetectMode(string(mode)); err != nil || mode == "" {
+			return err
+		}
+		c.detectMode = mode
+		return nil
+	}
+}
+
+// WithCoalescing sets whether identical concurrent requests share one upstream call, it is enabled by default
+func WithCoalescing(enabled bool) Option {
+	return func(c *Client) error {
+		c.flights = nil
+		if enabled {
+			c.flights = newFlightGroup()
+		}
+		return nil
+	}
+}
+
+// ParseDetectMode parses "deepl", "once" or "segment", an empty string is kept and
+// leaves the mode to the default of the Client
+func ParseDetectMode(s string) (DetectMode, error) {
+	switch mode := DetectMode(s); mode {
+	case "", DetectDeepL, DetectOnce, DetectPerSegment:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown detect mode %q, want deepl, once or segment", s)
+}
+
+// ParseFormality parses a formality, "more" and "less" of the official API are accepted too
+func ParseFormality(s string) (Formality, error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		return "", nil
+	case "formal", "more", "prefer_more":
+		return FormalityFormal, nil
+	case "informal", "less", "prefer_less":
+		return FormalityInformal, nil
+	}
+	return "", fmt.Errorf("unknown formality %q, want formal or informal", s)
+}
+
+// NewClient creates a Client, by default it talks to www2.deepl.com
+// with a randomized TLS fingerprint and no session
+func NewClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		baseURL:     DefaultBaseURL,
+		userAgent:   defaultUserAgent,
+		fingerprint: FingerprintRandomized,
+		concurrency: defaultConcurrency,
+		maxChars:    defaultMaxChars,
+		batchPolicy: FailFast,
+		detectMode:  DetectPerSegment,
+		flights:     newFlightGroup(),
+		retry:       DefaultRetryPolicy,
+		breakers:    newBreakers(defaultBreakerThreshold, defaultBreakerCooldown),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	c.slots = make(chan struct{}, c.concurrency)
+	c.httpClient = c.newHTTPClient(c.proxyURL)
+	if c.proxies != nil {
+		for _, proxy := range c.proxies.proxies {
+			c.proxyHTTP = append(c.proxyHTTP, c.newHTTPClient(proxy.url.String()))
+		}
+	}
+
+	c.headers = http.Header{
+		"Accept":          []string{"*/*"},
+		"Accept-Language": []string{"en-US,en;q=0.9,zh-CN;q=0.8,zh-TW;q=0.7,zh-HK;q=0.6,zh;q=0.5"},
+		"Authorization":   []string{"None"},
+		"Cache-Control":   []string{"no-cache"},
+		"Content-Type":    []string{"application/json"},
+		"DNT":             []string{"1"},
+		"Origin":          []string{"chrome-extension://cofdbpoegempjloogbagkncekinflcnj"},
+		"Pragma":          []string{"no-cache"},
+		"Priority":        []string{"u=1, i"},
+		"Referer":         []string{"https://www.deepl.com/"},
+		"Sec-Fetch-Dest":  []string{"empty"},
+		"Sec-Fetch-Mode":  []string{"cors"},
+		"Sec-Fetch-Site":  []string{"none"},
+		"Sec-GPC":         []string{"1"},
+		"User-Agent":      []string{c.userAgent},
+	}
+
+	return c, nil
+}
+
+// newHTTPClient creates an HTTP client with the configured fingerprint and timeout
+func (c *Client) newHTTPClient(proxyURL string) *req.Client {
+	httpClient := req.C()
+	switch c.fingerprint {
+	case FingerprintRandomized:
+		httpClient.SetTLSFingerprintRandomized()
+	case FingerprintChrome:
+		httpClient.SetTLSFingerprintChrome()
+	case FingerprintFirefox:
+		httpClient.SetTLSFingerprintFirefox()
+	case FingerprintSafari:
+		httpClient.SetTLSFingerprintSafari()
+	case FingerprintEdge:
+		httpClient.SetTLSFingerprintEdge()
+	}
+	if proxyURL != "" {
+		httpClient.SetProxyURL(proxyURL)
+	}
+	if c.timeout > 0 {
+		httpClient.SetTimeout(c.timeout)
+	}
+	return httpClient
+}
+
+// Session returns a copy of the client that uses the given dl_session.
+// The copy shares the underlying HTTP client and its connection pool.
+func (c *Client) Session(dlSession string) *Client {
+	clone := *c
+	clone.dlSession = dlSession
+	clone.pooled = false
+	return &clone
+}
+
+// Pooled returns a copy of the client that rotates across the sessions of WithSessionPool,
+// it returns nil when no pool is configured
+func (c *Client) Pooled() *Client {
+	if c.sessions == nil {
+		return nil
+	}
+	clone := *c
+	clone.dlSession = ""
+	clone.pooled = true
+	return &clone
+}
+
+// ProxyPool returns the pool set with WithProxyPool, or nil
+func (c *Client) ProxyPool() *ProxyPool {
+	return c.proxies
+}
+
+// CircuitStates returns the circuit of every upstream identity that failed recently,
+// keyed by proxy and masked session
+func (c *Client) CircuitStates() map[string]CircuitState {
+	if c.breakers == nil {
+		return nil
+	}
+	return c.breakers.states()
+}
+
+// SessionPool returns the pool set with WithSessionPool, or nil
+func (c *Client) SessionPool() *SessionPool {
+	return c.sessions
+}
+
+// TranslationMemory returns the translation memory set with WithTranslationMemory, or nil
+func (c *Client) TranslationMemory() *TranslationMemory {
+	return c.memory
+}
+
+// defaultClients holds the clients used by TranslateByDeepLX, keyed by proxy URL
+var defaultClients sync.Map
+
+// defaultClient returns the shared client for the given proxy URL
+func defaultClient(proxyURL string) (*Client, error) {
+	if c, ok := defaultClients.Load(proxyURL); ok {
+		return c.(*Client), nil
+	}
+	c, err := NewClient(WithProxy(proxyURL))
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := defaultClients.LoadOrStore(proxyURL, c)
+	return actual.(*Client), nil
+}
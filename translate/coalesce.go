@@ -0,0 +1,83 @@
+package translate
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// flightKey identifies requests that can share an upstream call
+type flightKey struct {
+	Request
+	dlSession string
+	pooled    bool
+}
+
+// flight is a translation in progress and the callers waiting for it
+type flight struct {
+	done    chan struct{}
+	result  DeepLXTranslationResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup deduplicates identical concurrent translations. Unlike a plain singleflight
+// the shared call is only cancelled once every caller waiting for it has gone.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[flightKey]*flight
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[flightKey]*flight)}
+}
+
+// do runs fn once for concurrent calls with the same key and hands its result to all of them
+func (g *flightGroup) do(ctx context.Context, key flightKey, fn func(ctx context.Context) (DeepLXTranslationResult, error)) (DeepLXTranslationResult, error) {
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		// The call outlives the caller that started it as long as others wait for it
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go func() {
+			f.result, f.err = fn(callCtx)
+			cancel()
+			g.forget(key, f)
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		// Every caller gets its own copy of the slices
+		result := f.result
+		result.Alternatives = slices.Clone(result.Alternatives)
+		result.SourceLangs = slices.Clone(result.SourceLangs)
+		return result, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+		}
+		g.mu.Unlock()
+		return DeepLXTranslationResult{}, ctx.Err()
+	}
+}
+
+// forget removes a finished flight so later requests start a new one
+func (g *flightGroup) forget(key flightKey, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
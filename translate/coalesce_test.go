@@ -0,0 +1,108 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForWaiters blocks until n callers are waiting for the flight of key
+func waitForWaiters(t *testing.T, g *flightGroup, key flightKey, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		f := g.flights[key]
+		joined := f != nil && f.waiters == n
+		g.mu.Unlock()
+		if joined {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d waiters did not join", n)
+}
+
+func TestFlightGroupShares(t *testing.T) {
+	g := newFlightGroup()
+	key := flightKey{Request: Request{TargetLang: "DE", Text: "Hello"}}
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (DeepLXTranslationResult, error) {
+		calls.Add(1)
+		<-release
+		return DeepLXTranslationResult{Data: "Hallo", Alternatives: []string{"Guten Tag"}}, nil
+	}
+
+	const n = 10
+	results := make([]DeepLXTranslationResult, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do(context.Background(), key, fn)
+		}(i)
+	}
+	waitForWaiters(t, g, key, n)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("fn called %d times, want 1", calls.Load())
+	}
+	for i, result := range results {
+		if result.Data != "Hallo" || len(result.Alternatives) != 1 {
+			t.Errorf("result %d = %+v", i, result)
+		}
+	}
+	results[0].Alternatives[0] = "changed"
+	if results[1].Alternatives[0] != "Guten Tag" {
+		t.Error("callers share the Alternatives slice")
+	}
+	if len(g.flights) != 0 {
+		t.Errorf("%d flights left behind", len(g.flights))
+	}
+}
+
+func TestFlightGroupCancellation(t *testing.T) {
+	g := newFlightGroup()
+	key := flightKey{Request: Request{TargetLang: "DE", Text: "Hello"}}
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (DeepLXTranslationResult, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return DeepLXTranslationResult{}, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { _, err := g.do(first, key, fn); errs <- err }()
+	go func() { _, err := g.do(second, key, fn); errs <- err }()
+	waitForWaiters(t, g, key, 2)
+
+	// The shared call keeps running while a caller still waits for it
+	cancelFirst()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller err = %v", err)
+	}
+	select {
+	case <-cancelled:
+		t.Fatal("shared call cancelled while a caller was still waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelSecond()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("second caller err = %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shared call not cancelled after every caller left")
+	}
+}
@@ -0,0 +1,391 @@
+// Package deepltest provides an in-process fake of the DeepL JSON-RPC endpoint
+// for tests that must not reach www2.deepl.com.
+package deepltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Sentence is a sentence as exchanged with the JSON-RPC endpoint
+type Sentence struct {
+	Prefix string `json:"prefix"`
+	Text   string `json:"text"`
+	ID     int    `json:"id,omitempty"`
+}
+
+// Job is a single LMT_handle_jobs job
+type Job struct {
+	Kind               string     `json:"kind"`
+	PreferredNumBeams  int        `json:"preferred_num_beams"`
+	RawEnContextBefore []string   `json:"raw_en_context_before"`
+	RawEnContextAfter  []string   `json:"raw_en_context_after"`
+	Sentences          []Sentence `json:"sentences"`
+}
+
+// Params holds the request parameters the fake understands
+type Params struct {
+	CommonJobParams struct {
+		Mode            string `json:"mode"`
+		RegionalVariant string `json:"regionalVariant"`
+		Formality       string `json:"formality"`
+	} `json:"commonJobParams"`
+	Lang struct {
+		SourceLangComputed string `json:"source_lang_computed"`
+		TargetLang         string `json:"target_lang"`
+		LangUserSelected   string `json:"lang_user_selected"`
+	} `json:"lang"`
+	Texts    []string `json:"texts"`
+	TextType string   `json:"textType"`
+	Jobs     []Job    `json:"jobs"`
+}
+
+// Call is a request received by the fake
+type Call struct {
+	Method string
+	ID     int64
+	Params Params
+	Header http.Header
+}
+
+// Failure describes an error response returned instead of a result
+type Failure struct {
+	StatusCode int         // HTTP status, defaults to 200 for JSON-RPC errors
+	Code       int64       // JSON-RPC error code, no error object is written if zero
+	Message    string      // JSON-RPC error message
+	Body       string      // raw body written verbatim when set
+	Header     http.Header // extra response headers, e.g. Retry-After
+}
+
+// RateLimited is the failure DeepL returns when an IP is throttled
+var RateLimited = Failure{Code: 1042912, Message: "Too many requests"}
+
+// TranslateFunc produces the text of a beam for a sentence
+type TranslateFunc func(text, sourceLang, targetLang string, beam int) string
+
+// DefaultTranslate prefixes the text with the target language, alternatives get the beam number
+func DefaultTranslate(text, sourceLang, targetLang string, beam int) string {
+	if beam == 0 {
+		return fmt.Sprintf("[%s] %s", targetLang, text)
+	}
+	return fmt.Sprintf("[%s#%d] %s", targetLang, beam, text)
+}
+
+// Server is a fake DeepL JSON-RPC endpoint, its URL can be passed to translate.WithBaseURL
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	translate  TranslateFunc
+	detected   string
+	beams      int
+	brotli     bool
+	session    string
+	rateLimit  int
+	failures   map[string][]Failure
+	calls      []Call
+	successful int
+}
+
+// NewServer starts a fake endpoint, callers must Close it
+func NewServer() *Server {
+	s := &Server{
+		translate: DefaultTranslate,
+		detected:  "EN",
+		beams:     3,
+		rateLimit: -1,
+		failures:  make(map[string][]Failure),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// SetTranslateFunc replaces the function generating translations
+func (s *Server) SetTranslateFunc(fn TranslateFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.translate = fn
+}
+
+// SetDetectedLang sets the language LMT_split_text reports as detected
+func (s *Server) SetDetectedLang(lang string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.detected = lang
+}
+
+// SetBeams sets the maximum number of beams returned per sentence
+func (s *Server) SetBeams(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beams = n
+}
+
+// SetBrotli makes the fake compress its responses with brotli
+func (s *Server) SetBrotli(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.brotli = enabled
+}
+
+// RequireSession rejects requests without this dl_session cookie with 401
+func (s *Server) RequireSession(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = session
+}
+
+// RateLimitAfter answers every call after n successful ones with RateLimited, a negative n disables it
+func (s *Server) RateLimitAfter(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit = n
+	s.successful = 0
+}
+
+// FailNext queues failures returned by the next calls of method, in order
+func (s *Server) FailNext(method string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failures...)
+}
+
+// Calls returns the requests received so far
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// CallCount returns how many requests of method were received, all methods if empty
+func (s *Server) CallCount(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Jsonrpc string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		ID      int64  `json:"id"`
+		Params  Params `json:"params"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		s.write(w, http.StatusBadRequest, map[string]any{
+			"jsonrpc": "2.0",
+			"error":   map[string]any{"code": -32700, "message": "Parse error"},
+		})
+		return
+	}
+	if method := r.URL.Query().Get("method"); method != request.Method {
+		s.write(w, http.StatusBadRequest, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"error":   map[string]any{"code": -32600, "message": "Invalid Request"},
+		})
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: request.Method, ID: request.ID, Params: request.Params, Header: r.Header.Clone()})
+	failure, failed := s.nextFailure(request.Method)
+	if !failed && s.session != "" {
+		if cookie, err := r.Cookie("dl_session"); err != nil || cookie.Value != s.session {
+			failure, failed = Failure{StatusCode: http.StatusUnauthorized, Body: "Unauthorized"}, true
+		}
+	}
+	if !failed && s.rateLimit >= 0 && s.successful >= s.rateLimit {
+		failure, failed = RateLimited, true
+	}
+	if !failed {
+		s.successful++
+	}
+	translate, detected, beams := s.translate, s.detected, s.beams
+	s.mu.Unlock()
+
+	if failed {
+		s.writeFailure(w, request.ID, failure)
+		return
+	}
+
+	var result any
+	switch request.Method {
+	case "LMT_split_text":
+		result = splitText(request.Params, detected)
+	case "LMT_handle_jobs":
+		result = handleJobs(request.Params, translate, beams)
+	default:
+		s.write(w, http.StatusOK, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"error":   map[string]any{"code": -32601, "message": "Method not found"},
+		})
+		return
+	}
+	s.write(w, http.StatusOK, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      request.ID,
+		"result":  result,
+	})
+}
+
+// nextFailure pops the next queued failure of method, s.mu must be held
+func (s *Server) nextFailure(method string) (Failure, bool) {
+	queue := s.failures[method]
+	if len(queue) == 0 {
+		return Failure{}, false
+	}
+	s.failures[method] = queue[1:]
+	return queue[0], true
+}
+
+func (s *Server) writeFailure(w http.ResponseWriter, id int64, failure Failure) {
+	status := failure.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	for k, v := range failure.Header {
+		w.Header()[k] = v
+	}
+	if failure.Body != "" || failure.Code == 0 {
+		w.WriteHeader(status)
+		io.WriteString(w, failure.Body)
+		return
+	}
+	s.write(w, status, map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   map[string]any{"code": failure.Code, "message": failure.Message},
+	})
+}
+
+func (s *Server) write(w http.ResponseWriter, status int, v any) {
+	data, _ := json.Marshal(v)
+
+	s.mu.Lock()
+	compress := s.brotli
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if compress {
+		var buf bytes.Buffer
+		bw := brotli.NewWriter(&buf)
+		bw.Write(data)
+		bw.Close()
+		data = buf.Bytes()
+		w.Header().Set("Content-Encoding", "br")
+	}
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+var sentenceEnd = regexp.MustCompile(`[.!?。！？]\s+`)
+
+// splitSentences splits text after sentence terminators followed by whitespace
+func splitSentences(text string) []string {
+	var sentences []string
+	for {
+		loc := sentenceEnd.FindStringIndex(text)
+		if loc == nil {
+			break
+		}
+		sentences = append(sentences, strings.TrimSpace(text[:loc[1]]))
+		text = text[loc[1]:]
+	}
+	if strings.TrimSpace(text) != "" {
+		sentences = append(sentences, strings.TrimSpace(text))
+	}
+	return sentences
+}
+
+func splitText(params Params, detected string) any {
+	type chunk struct {
+		Sentences []Sentence `json:"sentences"`
+	}
+	type text struct {
+		Chunks []chunk `json:"chunks"`
+	}
+
+	texts := make([]text, 0, len(params.Texts))
+	for _, t := range params.Texts {
+		var chunks []chunk
+		for _, sentence := range splitSentences(t) {
+			chunks = append(chunks, chunk{Sentences: []Sentence{{Text: sentence}}})
+		}
+		texts = append(texts, text{Chunks: chunks})
+	}
+	return map[string]any{
+		"lang": map[string]any{
+			"detected":    detected,
+			"isConfident": true,
+		},
+		"texts": texts,
+	}
+}
+
+func handleJobs(params Params, translate TranslateFunc, maxBeams int) any {
+	type beam struct {
+		Sentences  []map[string]any `json:"sentences"`
+		NumSymbols int              `json:"num_symbols"`
+	}
+	type translation struct {
+		Beams   []beam `json:"beams"`
+		Quality string `json:"quality"`
+	}
+
+	targetLang := params.Lang.TargetLang
+	if params.CommonJobParams.RegionalVariant != "" {
+		targetLang = params.CommonJobParams.RegionalVariant
+	}
+
+	translations := make([]translation, 0, len(params.Jobs))
+	for _, job := range params.Jobs {
+		numBeams := job.PreferredNumBeams
+		if numBeams <= 0 || numBeams > maxBeams {
+			numBeams = maxBeams
+		}
+		if numBeams < 1 {
+			numBeams = 1
+		}
+
+		var beams []beam
+		for i := 0; i < numBeams; i++ {
+			var sentences []map[string]any
+			for _, sentence := range job.Sentences {
+				text := translate(sentence.Text, params.Lang.SourceLangComputed, targetLang, i)
+				sentences = append(sentences, map[string]any{"text": text, "ids": []int{sentence.ID}})
+			}
+			beams = append(beams, beam{Sentences: sentences, NumSymbols: len(sentences)})
+		}
+		translations = append(translations, translation{Beams: beams, Quality: "normal"})
+	}
+	return map[string]any{
+		"translations":             translations,
+		"target_lang":              params.Lang.TargetLang,
+		"source_lang":              params.Lang.SourceLangComputed,
+		"source_lang_is_confident": false,
+		"detectedLanguages":        map[string]any{},
+	}
+}
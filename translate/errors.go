@@ -0,0 +1,115 @@
+package translate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// Sentinel errors describing why a translation failed, test them with errors.Is
+var (
+	ErrEmptyText           = errors.New("no text to translate")
+	ErrRateLimited         = errors.New("too many requests, your IP has been blocked by DeepL temporarily")
+	ErrUnsupportedLanguage = errors.New("unsupported language")
+	ErrUpstreamProtocol    = errors.New("unexpected response from DeepL")
+	ErrSessionInvalid      = errors.New("dl_session was rejected by DeepL, it may be invalid or expired")
+	ErrUpstreamUnavailable = errors.New("upstream temporarily unavailable")
+	ErrAuthKeyInvalid      = errors.New("API authentication key was rejected")
+	ErrGlossaryNotFound    = errors.New("glossary not found")
+)
+
+// JSON-RPC error codes returned by DeepL
+const (
+	rpcCodeTooManyRequests      = 1042911
+	rpcCodeTooManyRequestsProxy = 1042912
+)
+
+// Error is a failure reported by the DeepL endpoint.
+// It unwraps to one of the sentinel errors above.
+type Error struct {
+	Kind       error         // sentinel error describing the failure
+	Method     string        // JSON-RPC method, e.g. LMT_handle_jobs
+	StatusCode int           // HTTP status code of the upstream response
+	Code       int64         // JSON-RPC error code, zero if the response had none
+	Message    string        // message reported by DeepL
+	RetryAfter time.Duration // delay requested by the Retry-After header, zero if absent
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Kind.Error())
+	if e.Method != "" {
+		b.WriteString(" (" + e.Method)
+		if e.Code != 0 {
+			fmt.Fprintf(&b, ", code %d", e.Code)
+		} else if e.StatusCode != 0 {
+			fmt.Fprintf(&b, ", status %d", e.StatusCode)
+		}
+		b.WriteString(")")
+	}
+	if e.Message != "" && !strings.EqualFold(e.Message, e.Kind.Error()) {
+		b.WriteString(": " + e.Message)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// checkResponse turns an upstream response into an *Error if it reports a failure
+func checkResponse(method string, statusCode int, hasSession bool, body []byte) error {
+	newError := func(kind error, code int64, message string) error {
+		return &Error{Kind: kind, Method: method, StatusCode: statusCode, Code: code, Message: message}
+	}
+
+	if !gjson.ValidBytes(body) {
+		switch {
+		case statusCode == http.StatusTooManyRequests:
+			return newError(ErrRateLimited, 0, "")
+		case (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden) && hasSession:
+			return newError(ErrSessionInvalid, 0, "")
+		}
+		return newError(ErrUpstreamProtocol, 0, "response is not valid JSON")
+	}
+
+	rpcError := gjson.GetBytes(body, "error")
+	if rpcError.Exists() {
+		code := rpcError.Get("code").Int()
+		message := rpcError.Get("message").String()
+		return newError(classifyRPCError(code, message, statusCode, hasSession), code, message)
+	}
+
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return newError(ErrRateLimited, 0, "")
+	case (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden) && hasSession:
+		return newError(ErrSessionInvalid, 0, "")
+	case statusCode >= http.StatusBadRequest:
+		return newError(ErrUpstreamProtocol, 0, http.StatusText(statusCode))
+	case !gjson.GetBytes(body, "result").Exists():
+		return newError(ErrUpstreamProtocol, 0, "response has no result")
+	}
+	return nil
+}
+
+// classifyRPCError picks the sentinel error matching a JSON-RPC error object
+func classifyRPCError(code int64, message string, statusCode int, hasSession bool) error {
+	lower := strings.ToLower(message)
+	switch {
+	case code == rpcCodeTooManyRequests || code == rpcCodeTooManyRequestsProxy,
+		statusCode == http.StatusTooManyRequests,
+		strings.Contains(lower, "too many requests"):
+		return ErrRateLimited
+	case hasSession && (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden ||
+		strings.Contains(lower, "session") || strings.Contains(lower, "unauthorized")):
+		return ErrSessionInvalid
+	case strings.Contains(lower, "lang"):
+		return ErrUnsupportedLanguage
+	}
+	return ErrUpstreamProtocol
+}
@@ -0,0 +1,81 @@
+package translate
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// GoogleWebURL is the endpoint used by the Google Translate web widgets
+const GoogleWebURL = "https://translate.googleapis.com"
+
+// GoogleClient translates through the keyless Google Translate web endpoint.
+// It is safe for concurrent use.
+type GoogleClient struct {
+	providerClient
+}
+
+// NewGoogleClient creates a client for Google Translate web
+func NewGoogleClient(opts ...ProviderOption) (*GoogleClient, error) {
+	c, err := newProviderClient(GoogleWebURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleClient{providerClient: c}, nil
+}
+
+// googleLang turns a DeepL language code into the one Google expects, Chinese needs its script
+func googleLang(lang string) string {
+	switch strings.ToUpper(lang) {
+	case "ZH", "ZH-HANS":
+		return "zh-CN"
+	case "ZH-HANT":
+		return "zh-TW"
+	}
+	return isoLang(lang)
+}
+
+// TranslateContext translates r with Google Translate. The response is split into
+// sentences which are joined back together, tags are not handled.
+func (c *GoogleClient) TranslateContext(ctx context.Context, r Request) (DeepLXTranslationResult, error) {
+	if r.Text == "" {
+		return DeepLXTranslationResult{}, ErrEmptyText
+	}
+	data, err := c.send(ctx, c.httpClient.R().
+		SetQueryParam("client", "gtx").
+		SetQueryParam("dt", "t").
+		SetQueryParam("sl", googleLang(r.SourceLang)).
+		SetQueryParam("tl", googleLang(r.TargetLang)).
+		SetFormData(map[string]string{"q": r.Text}), http.MethodPost, c.baseURL+"/translate_a/single", checkGoogleResponse)
+	if err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+
+	var text strings.Builder
+	for _, sentence := range gjson.GetBytes(data, "0").Array() {
+		text.WriteString(sentence.Get("0").String())
+	}
+	return DeepLXTranslationResult{
+		Code:         http.StatusOK,
+		Data:         text.String(),
+		Alternatives: []string{},
+		SourceLang:   strings.ToUpper(gjson.GetBytes(data, "2").String()),
+		TargetLang:   strings.ToUpper(r.TargetLang),
+		Method:       "Google",
+		Attempts:     1,
+	}, nil
+}
+
+// checkGoogleResponse turns a Google Translate response into an *Error if it reports a failure
+func checkGoogleResponse(statusCode int, body []byte) error {
+	const method = "google/translate_a/single"
+	if err := statusError(method, statusCode, ""); err != nil {
+		return err
+	}
+	if !gjson.ValidBytes(body) || !gjson.GetBytes(body, "0").IsArray() {
+		return &Error{Kind: ErrUpstreamProtocol, Method: method, StatusCode: statusCode, Message: "response has no sentences"}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package translate
+
+import "strings"
+
+// Language is a language DeepL translates from or to
+type Language struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Source bool   `json:"source"` // false for regional variants, which are only accepted as target
+}
+
+// languages lists the languages supported by DeepL, a regional variant follows its language
+var languages = []Language{
+	{"AR", "Arabic", true},
+	{"BG", "Bulgarian", true},
+	{"CS", "Czech", true},
+	{"DA", "Danish", true},
+	{"DE", "German", true},
+	{"EL", "Greek", true},
+	{"EN", "English", true},
+	{"EN-GB", "English (British)", false},
+	{"EN-US", "English (American)", false},
+	{"ES", "Spanish", true},
+	{"ES-419", "Spanish (Latin American)", false},
+	{"ET", "Estonian", true},
+	{"FI", "Finnish", true},
+	{"FR", "French", true},
+	{"HE", "Hebrew", true},
+	{"HU", "Hungarian", true},
+	{"ID", "Indonesian", true},
+	{"IT", "Italian", true},
+	{"JA", "Japanese", true},
+	{"KO", "Korean", true},
+	{"LT", "Lithuanian", true},
+	{"LV", "Latvian", true},
+	{"NB", "Norwegian Bokmål", true},
+	{"NL", "Dutch", true},
+	{"PL", "Polish", true},
+	{"PT", "Portuguese", true},
+	{"PT-BR", "Portuguese (Brazilian)", false},
+	{"PT-PT", "Portuguese (European)", false},
+	{"RO", "Romanian", true},
+	{"RU", "Russian", true},
+	{"SK", "Slovak", true},
+	{"SL", "Slovenian", true},
+	{"SV", "Swedish", true},
+	{"TH", "Thai", true},
+	{"TR", "Turkish", true},
+	{"UK", "Ukrainian", true},
+	{"VI", "Vietnamese", true},
+	{"ZH", "Chinese", true},
+	{"ZH-HANS", "Chinese (simplified)", false},
+	{"ZH-HANT", "Chinese (traditional)", false},
+}
+
+// Languages returns every supported language in alphabetical order of their code
+func Languages() []Language {
+	return append([]Language(nil), languages...)
+}
+
+// LookupLanguage returns the language of code, case insensitive
+func LookupLanguage(code string) (Language, bool) {
+	for _, lang := range languages {
+		if strings.EqualFold(lang.Code, code) {
+			return lang, true
+		}
+	}
+	return Language{}, false
+}
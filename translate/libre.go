@@ -0,0 +1,82 @@
+package translate
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// LibreClient translates through a LibreTranslate compatible server.
+// It is safe for concurrent use.
+type LibreClient struct {
+	providerClient
+	apiKey string
+}
+
+// NewLibreClient creates a client for the LibreTranslate server at baseURL,
+// apiKey may be empty when the server does not require one
+func NewLibreClient(baseURL, apiKey string, opts ...ProviderOption) (*LibreClient, error) {
+	c, err := newProviderClient(baseURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &LibreClient{providerClient: c, apiKey: apiKey}, nil
+}
+
+// libreRequest is the body of POST /translate
+type libreRequest struct {
+	Q      string `json:"q"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Format string `json:"format"`
+	APIKey string `json:"api_key,omitempty"`
+}
+
+// TranslateContext translates r with LibreTranslate, html and xml tags are preserved
+func (c *LibreClient) TranslateContext(ctx context.Context, r Request) (DeepLXTranslationResult, error) {
+	if r.Text == "" {
+		return DeepLXTranslationResult{}, ErrEmptyText
+	}
+	format := "text"
+	if r.TagHandling != "" {
+		format = "html"
+	}
+	data, err := c.send(ctx, c.httpClient.R().SetBodyJsonMarshal(libreRequest{
+		Q:      r.Text,
+		Source: isoLang(r.SourceLang),
+		Target: isoLang(r.TargetLang),
+		Format: format,
+		APIKey: c.apiKey,
+	}), http.MethodPost, c.baseURL+"/translate", checkLibreResponse)
+	if err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+
+	sourceLang := strings.ToUpper(r.SourceLang)
+	if detected := gjson.GetBytes(data, "detectedLanguage.language").String(); detected != "" {
+		sourceLang = strings.ToUpper(detected)
+	}
+	return DeepLXTranslationResult{
+		Code:         http.StatusOK,
+		Data:         gjson.GetBytes(data, "translatedText").String(),
+		Alternatives: []string{},
+		SourceLang:   sourceLang,
+		TargetLang:   strings.ToUpper(r.TargetLang),
+		Method:       "LibreTranslate",
+		Attempts:     1,
+	}, nil
+}
+
+// checkLibreResponse turns a LibreTranslate response into an *Error if it reports a failure
+func checkLibreResponse(statusCode int, body []byte) error {
+	const method = "libre/translate"
+	if err := statusError(method, statusCode, gjson.GetBytes(body, "error").String()); err != nil {
+		return err
+	}
+	if !gjson.GetBytes(body, "translatedText").Exists() {
+		return &Error{Kind: ErrUpstreamProtocol, Method: method, StatusCode: statusCode, Message: "response has no translation"}
+	}
+	return nil
+}
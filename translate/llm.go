@@ -0,0 +1,111 @@
+package translate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// DefaultLLMModel is the model asked for translations when none is configured
+const DefaultLLMModel = "gpt-4o-mini"
+
+// LLMClient translates by prompting a model behind an OpenAI compatible
+// chat completions endpoint. It is safe for concurrent use.
+type LLMClient struct {
+	providerClient
+	apiKey string
+	model  string
+}
+
+// NewLLMClient creates a client for the OpenAI compatible API at baseURL, for example
+// https://api.openai.com/v1. An empty model uses DefaultLLMModel.
+func NewLLMClient(baseURL, apiKey, model string, opts ...ProviderOption) (*LLMClient, error) {
+	c, err := newProviderClient(baseURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if model == "" {
+		model = DefaultLLMModel
+	}
+	return &LLMClient{providerClient: c, apiKey: apiKey, model: model}, nil
+}
+
+type llmMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// llmRequest is the body of POST /chat/completions
+type llmRequest struct {
+	Model       string       `json:"model"`
+	Messages    []llmMessage `json:"messages"`
+	Temperature float64      `json:"temperature"`
+}
+
+// llmPrompt is the system prompt that turns the model into a translation engine
+func llmPrompt(r Request) string {
+	var b strings.Builder
+	b.WriteString("You are a translation engine. Translate the user's text")
+	if r.SourceLang != "" {
+		fmt.Fprintf(&b, " from language code %s", strings.ToUpper(r.SourceLang))
+	}
+	fmt.Fprintf(&b, " to language code %s. Reply with the translation only, without notes or quotes.", strings.ToUpper(r.TargetLang))
+	if r.TagHandling != "" {
+		fmt.Fprintf(&b, " The text is %s, keep every tag unchanged.", strings.ToUpper(r.TagHandling))
+	} else {
+		b.WriteString(" Keep line breaks and formatting unchanged.")
+	}
+	if r.Formality != "" {
+		fmt.Fprintf(&b, " Use the %s register.", r.Formality)
+	}
+	if r.Context != "" {
+		fmt.Fprintf(&b, "\n\nThe text follows this context, which must not be translated:\n%s", r.Context)
+	}
+	return b.String()
+}
+
+// TranslateContext translates r by prompting the model
+func (c *LLMClient) TranslateContext(ctx context.Context, r Request) (DeepLXTranslationResult, error) {
+	if r.Text == "" {
+		return DeepLXTranslationResult{}, ErrEmptyText
+	}
+	request := c.httpClient.R().SetBodyJsonMarshal(llmRequest{
+		Model: c.model,
+		Messages: []llmMessage{
+			{Role: "system", Content: llmPrompt(r)},
+			{Role: "user", Content: r.Text},
+		},
+	})
+	if c.apiKey != "" {
+		request.SetBearerAuthToken(c.apiKey)
+	}
+	data, err := c.send(ctx, request, http.MethodPost, c.baseURL+"/chat/completions", checkLLMResponse)
+	if err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+
+	return DeepLXTranslationResult{
+		Code:         http.StatusOK,
+		Data:         strings.TrimSpace(gjson.GetBytes(data, "choices.0.message.content").String()),
+		Alternatives: []string{},
+		SourceLang:   strings.ToUpper(r.SourceLang),
+		TargetLang:   strings.ToUpper(r.TargetLang),
+		Method:       "LLM",
+		Attempts:     1,
+	}, nil
+}
+
+// checkLLMResponse turns a chat completions response into an *Error if it reports a failure
+func checkLLMResponse(statusCode int, body []byte) error {
+	const method = "llm/chat/completions"
+	if err := statusError(method, statusCode, gjson.GetBytes(body, "error.message").String()); err != nil {
+		return err
+	}
+	if !gjson.GetBytes(body, "choices.0.message.content").Exists() {
+		return &Error{Kind: ErrUpstreamProtocol, Method: method, StatusCode: statusCode, Message: "response has no choices"}
+	}
+	return nil
+}
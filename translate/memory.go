@@ -0,0 +1,315 @@
+package translate
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// segmentsBucket holds the stored line translations
+var segmentsBucket = []byte("segments")
+
+// TranslationMemory persists line translations in a BoltDB file so they
+// survive restarts. It is safe for concurrent use.
+type TranslationMemory struct {
+	db *bolt.DB
+}
+
+// memoryRecord is the value stored for every segment
+type memoryRecord struct {
+	Key     CacheKey   `json:"key"`
+	Entry   CacheEntry `json:"entry"`
+	Created time.Time  `json:"created"`
+}
+
+// OpenTranslationMemory opens or creates the translation memory at path
+func OpenTranslationMemory(path string) (*TranslationMemory, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open translation memory: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(segmentsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open translation memory: %w", err)
+	}
+	return &TranslationMemory{db: db}, nil
+}
+
+// Close closes the underlying file
+func (tm *TranslationMemory) Close() error {
+	return tm.db.Close()
+}
+
+// memoryKey hashes a CacheKey, texts can be longer than BoltDB allows for keys
+func memoryKey(key CacheKey) []byte {
+	h := sha256.New()
+	for _, field := range []string{key.SourceLang, key.TargetLang, key.TagHandling, key.RegionalVariant, key.Text} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	// Appended only when set so that segments stored before these fields existed keep their key
+	if key.Formality != "" {
+		h.Write([]byte(key.Formality))
+		h.Write([]byte{0})
+	}
+	if key.Context != "" {
+		h.Write([]byte("context=" + key.Context))
+		h.Write([]byte{0})
+	}
+	if key.Beams != 0 {
+		h.Write([]byte("beams=" + strconv.Itoa(key.Beams)))
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil)
+}
+
+// Get returns the stored translation of key
+func (tm *TranslationMemory) Get(key CacheKey) (CacheEntry, bool) {
+	var record memoryRecord
+	found := false
+	tm.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(segmentsBucket).Get(memoryKey(key))
+		if data != nil && json.Unmarshal(data, &record) == nil {
+			found = true
+		}
+		return nil
+	})
+	return record.Entry, found
+}
+
+// Set stores the translation of key, replacing a previous one
+func (tm *TranslationMemory) Set(key CacheKey, entry CacheEntry) {
+	tm.SetMany([]CacheKey{key}, []CacheEntry{entry})
+}
+
+// SetMany stores several translations in a single transaction
+func (tm *TranslationMemory) SetMany(keys []CacheKey, entries []CacheEntry) error {
+	now := time.Now().UTC()
+	records := make([]memoryRecord, len(keys))
+	for i, key := range keys {
+		records[i] = memoryRecord{Key: key, Entry: entries[i], Created: now}
+	}
+	return tm.put(records...)
+}
+
+func (tm *TranslationMemory) put(records ...memoryRecord) error {
+	return tm.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(segmentsBucket)
+		for _, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(memoryKey(record.Key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Len returns the number of stored segments
+func (tm *TranslationMemory) Len() int {
+	n := 0
+	tm.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(segmentsBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// TMX properties carrying what the language pair alone does not describe
+const (
+	tmxPropSource      = "x-deeplx-source-lang"
+	tmxPropTagHandling = "x-deeplx-tag-handling"
+	tmxPropFormality   = "x-deeplx-formality"
+	tmxPropContext     = "x-deeplx-context"
+	tmxPropBeams       = "x-deeplx-beams"
+	tmxPropAlternative = "x-deeplx-alternative"
+	tmxDateFormat      = "20060102T150405Z"
+)
+
+type tmxDocument struct {
+	XMLName xml.Name  `xml:"tmx"`
+	Version string    `xml:"version,attr"`
+	Header  tmxHeader `xml:"header"`
+	Units   []tmxUnit `xml:"body>tu"`
+}
+
+type tmxHeader struct {
+	CreationTool        string `xml:"creationtool,attr"`
+	CreationToolVersion string `xml:"creationtoolversion,attr"`
+	SegType             string `xml:"segtype,attr"`
+	OTMF                string `xml:"o-tmf,attr"`
+	AdminLang           string `xml:"adminlang,attr"`
+	SrcLang             string `xml:"srclang,attr"`
+	DataType            string `xml:"datatype,attr"`
+}
+
+type tmxUnit struct {
+	CreationDate string       `xml:"creationdate,attr,omitempty"`
+	Props        []tmxProp    `xml:"prop"`
+	Variants     []tmxVariant `xml:"tuv"`
+}
+
+type tmxProp struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type tmxVariant struct {
+	Lang    string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Segment string `xml:"seg"`
+}
+
+// ExportTMX writes every stored segment as a TMX 1.4 document
+func (tm *TranslationMemory) ExportTMX(w io.Writer) error {
+	doc := tmxDocument{
+		Version: "1.4",
+		Header: tmxHeader{
+			CreationTool:        "DeepLX",
+			CreationToolVersion: "1",
+			SegType:             "sentence",
+			OTMF:                "DeepLX",
+			AdminLang:           "en",
+			SrcLang:             "*all*",
+			DataType:            "plaintext",
+		},
+	}
+
+	err := tm.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(segmentsBucket).ForEach(func(_, data []byte) error {
+			var record memoryRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+			doc.Units = append(doc.Units, newTMXUnit(record))
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func newTMXUnit(record memoryRecord) tmxUnit {
+	sourceLang := record.Entry.SourceLang
+	if sourceLang == "" {
+		sourceLang = record.Key.SourceLang
+	}
+	targetLang := record.Key.TargetLang
+	if record.Key.RegionalVariant != "" {
+		targetLang = record.Key.RegionalVariant
+	}
+
+	unit := tmxUnit{
+		Props: []tmxProp{{Type: tmxPropSource, Value: record.Key.SourceLang}},
+		Variants: []tmxVariant{
+			{Lang: sourceLang, Segment: record.Key.Text},
+			{Lang: targetLang, Segment: record.Entry.Text},
+		},
+	}
+	if !record.Created.IsZero() {
+		unit.CreationDate = record.Created.UTC().Format(tmxDateFormat)
+	}
+	if record.Key.TagHandling != "" {
+		unit.Props = append(unit.Props, tmxProp{Type: tmxPropTagHandling, Value: record.Key.TagHandling})
+	}
+	if record.Key.Formality != "" {
+		unit.Props = append(unit.Props, tmxProp{Type: tmxPropFormality, Value: record.Key.Formality})
+	}
+	if record.Key.Context != "" {
+		unit.Props = append(unit.Props, tmxProp{Type: tmxPropContext, Value: record.Key.Context})
+	}
+	if record.Key.Beams != 0 {
+		unit.Props = append(unit.Props, tmxProp{Type: tmxPropBeams, Value: strconv.Itoa(record.Key.Beams)})
+	}
+	for _, alternative := range record.Entry.Alternatives {
+		unit.Props = append(unit.Props, tmxProp{Type: tmxPropAlternative, Value: alternative})
+	}
+	return unit
+}
+
+// ImportTMX stores the translation units of a TMX document and returns how many were imported.
+// The first variant of a unit is the source, the second the translation; other variants are ignored.
+func (tm *TranslationMemory) ImportTMX(r io.Reader) (int, error) {
+	var doc tmxDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return 0, fmt.Errorf("parse TMX: %w", err)
+	}
+
+	var records []memoryRecord
+	for _, unit := range doc.Units {
+		if len(unit.Variants) < 2 || strings.TrimSpace(unit.Variants[0].Segment) == "" {
+			continue
+		}
+		source, target := unit.Variants[0], unit.Variants[1]
+
+		keySource := source.Lang
+		tagHandling := ""
+		var formality Formality
+		var context string
+		var beams int
+		var alternatives []string
+		for _, prop := range unit.Props {
+			switch prop.Type {
+			case tmxPropSource:
+				keySource = prop.Value
+			case tmxPropTagHandling:
+				tagHandling = prop.Value
+			case tmxPropFormality:
+				formality = Formality(prop.Value)
+			case tmxPropContext:
+				context = prop.Value
+			case tmxPropBeams:
+				beams, _ = strconv.Atoi(prop.Value)
+			case tmxPropAlternative:
+				alternatives = append(alternatives, prop.Value)
+			}
+		}
+		if strings.EqualFold(keySource, "AUTO") {
+			keySource = ""
+		}
+
+		created, _ := time.Parse(tmxDateFormat, unit.CreationDate)
+		key := newCacheKey(keySource, target.Lang, tagHandling, formality, source.Segment)
+		key.Context = context
+		key.Beams = beams
+		records = append(records, memoryRecord{
+			Key: key,
+			Entry: CacheEntry{
+				Text:         target.Segment,
+				Alternatives: alternatives,
+				SourceLang:   strings.ToUpper(source.Lang),
+			},
+			Created: created,
+		})
+	}
+
+	if err := tm.put(records...); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
@@ -0,0 +1,93 @@
+package translate_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OwO-Network/DeepLX/translate"
+)
+
+func openTestMemory(t *testing.T, path string) *translate.TranslationMemory {
+	t.Helper()
+	tm, err := translate.OpenTranslationMemory(path)
+	if err != nil {
+		t.Fatalf("OpenTranslationMemory: %v", err)
+	}
+	return tm
+}
+
+func TestTranslationMemoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm.db")
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "One\nTwo\nThree"}
+
+	tm := openTestMemory(t, path)
+	client, _ := newTestClient(t, translate.WithTranslationMemory(tm))
+	if _, err := client.Translate(req); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if tm.Len() != 3 {
+		t.Errorf("Len = %d, want 3", tm.Len())
+	}
+	if err := tm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted process only sends the changed line upstream
+	tm = openTestMemory(t, path)
+	defer tm.Close()
+	client, server := newTestClient(t, translate.WithTranslationMemory(tm))
+	result, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "One\nTwo!\nThree"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Data != "[DE] One\n[DE] Two!\n[DE] Three" || result.CacheHits != 2 || result.CacheMisses != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	calls := server.Calls()
+	if len(calls) != 2 || len(calls[0].Params.Texts) != 1 || calls[0].Params.Texts[0] != "Two!" {
+		t.Errorf("calls = %+v, want only the changed line", calls)
+	}
+}
+
+func TestTranslationMemoryTMX(t *testing.T) {
+	tm := openTestMemory(t, filepath.Join(t.TempDir(), "tm.db"))
+	defer tm.Close()
+	client, _ := newTestClient(t, translate.WithTranslationMemory(tm))
+	if _, err := client.Translate(translate.Request{TargetLang: "EN-GB", Text: "Hallo <b>Welt</b>", TagHandling: "html"}); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tm.ExportTMX(&buf); err != nil {
+		t.Fatalf("ExportTMX: %v", err)
+	}
+	tmx := buf.String()
+	for _, want := range []string{`<tmx version="1.4">`, `xml:lang="EN-GB"`, `<seg>Hallo &lt;b&gt;Welt&lt;/b&gt;</seg>`, `type="x-deeplx-tag-handling">html<`} {
+		if !strings.Contains(tmx, want) {
+			t.Errorf("TMX misses %s:\n%s", want, tmx)
+		}
+	}
+
+	imported := openTestMemory(t, filepath.Join(t.TempDir(), "imported.db"))
+	defer imported.Close()
+	n, err := imported.ImportTMX(strings.NewReader(tmx))
+	if err != nil || n != 1 {
+		t.Fatalf("ImportTMX = %d, %v", n, err)
+	}
+
+	// The imported segment is found under the same key as the original one
+	client, server := newTestClient(t, translate.WithTranslationMemory(imported))
+	result, err := client.Translate(translate.Request{TargetLang: "EN-GB", Text: "Hallo <b>Welt</b>", TagHandling: "html"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Data != "[EN-GB] Hallo <b>Welt</b>" || result.CacheHits != 1 || server.CallCount("") != 0 {
+		t.Errorf("result = %+v, upstream calls = %d", result, server.CallCount(""))
+	}
+
+	if _, err := imported.ImportTMX(strings.NewReader("<tmx")); err == nil {
+		t.Error("ImportTMX accepted malformed XML")
+	}
+}
@@ -0,0 +1,160 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// OfficialFreeURL serves API keys ending in ":fx"
+	OfficialFreeURL = "https://api-free.deepl.com"
+	// OfficialProURL serves every other API key
+	OfficialProURL = "https://api.deepl.com"
+
+	// statusQuotaExceeded is returned by the official API when the character quota is used up
+	statusQuotaExceeded = 456
+)
+
+// OfficialClient translates through the official DeepL API with an authentication key.
+// It is safe for concurrent use.
+type OfficialClient struct {
+	providerClient
+	authKey string
+}
+
+// NewOfficialClient creates a client for the official API. Keys ending in ":fx"
+// belong to the free plan and use api-free.deepl.com, others api.deepl.com,
+// WithProviderBaseURL overrides the endpoint.
+func NewOfficialClient(authKey string, opts ...ProviderOption) (*OfficialClient, error) {
+	if authKey == "" {
+		return nil, errors.New("DeepL API authentication key is empty")
+	}
+	baseURL := OfficialProURL
+	if strings.HasSuffix(authKey, ":fx") {
+		baseURL = OfficialFreeURL
+	}
+	c, err := newProviderClient(baseURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &OfficialClient{providerClient: c, authKey: authKey}, nil
+}
+
+// officialRequest is the body of POST /v2/translate
+type officialRequest struct {
+	Text        []string `json:"text"`
+	SourceLang  string   `json:"source_lang,omitempty"`
+	TargetLang  string   `json:"target_lang"`
+	TagHandling string   `json:"tag_handling,omitempty"`
+	Formality   string   `json:"formality,omitempty"`
+	Context     string   `json:"context,omitempty"`
+	GlossaryID  string   `json:"glossary_id,omitempty"`
+}
+
+// officialFormality maps a formality to the official API, the prefer_ values
+// do not fail for target languages without a formal address
+var officialFormality = map[Formality]string{
+	FormalityFormal:   "prefer_more",
+	FormalityInformal: "prefer_less",
+}
+
+// officialSourceLang maps a source language to the official API, which knows neither
+// "auto" nor regional variants. An empty code leaves the detection to DeepL.
+func officialSourceLang(lang string) string {
+	lang = strings.ToUpper(lang)
+	if lang == "AUTO" {
+		return ""
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	return base
+}
+
+// TranslateContext translates r with the official API. The API returns no alternatives,
+// and the cache and detect mode of the web client do not apply.
+func (c *OfficialClient) TranslateContext(ctx context.Context, r Request) (DeepLXTranslationResult, error) {
+	if r.Text == "" {
+		return DeepLXTranslationResult{}, ErrEmptyText
+	}
+	request := officialRequest{
+		Text:        []string{r.Text},
+		SourceLang:  officialSourceLang(r.SourceLang),
+		TargetLang:  strings.ToUpper(r.TargetLang),
+		TagHandling: r.TagHandling,
+		Formality:   officialFormality[r.Formality],
+		Context:     r.Context,
+	}
+	if r.Glossary != "" {
+		glossary, err := c.findGlossary(ctx, r)
+		if err != nil {
+			return DeepLXTranslationResult{}, err
+		}
+		// A glossary is bound to a language pair, the source cannot be detected
+		request.GlossaryID = glossary.Get("glossary_id").String()
+		request.SourceLang = strings.ToUpper(glossary.Get("source_lang").String())
+	}
+	data, err := c.send(ctx, c.httpClient.R().
+		SetHeader("Authorization", "DeepL-Auth-Key "+c.authKey).
+		SetBodyJsonMarshal(request), http.MethodPost, c.baseURL+"/v2/translate", checkOfficialResponse)
+	if err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+
+	translation := gjson.GetBytes(data, "translations.0")
+	return DeepLXTranslationResult{
+		Code:         http.StatusOK,
+		Data:         translation.Get("text").String(),
+		Alternatives: []string{},
+		SourceLang:   translation.Get("detected_source_language").String(),
+		TargetLang:   strings.ToUpper(r.TargetLang),
+		Method:       "Official",
+		Attempts:     1,
+	}, nil
+}
+
+// findGlossary looks up the glossary named r.Glossary for the languages of r among the glossaries of the account
+func (c *OfficialClient) findGlossary(ctx context.Context, r Request) (gjson.Result, error) {
+	data, err := c.send(ctx, c.httpClient.R().
+		SetHeader("Authorization", "DeepL-Auth-Key "+c.authKey), http.MethodGet, c.baseURL+"/v2/glossaries",
+		func(statusCode int, body []byte) error {
+			return statusError("v2/glossaries", statusCode, gjson.GetBytes(body, "message").String())
+		})
+	if err != nil {
+		return gjson.Result{}, err
+	}
+
+	sourceLang := isoLang(r.SourceLang)
+	targetLang := isoLang(r.TargetLang)
+	for _, glossary := range gjson.GetBytes(data, "glossaries").Array() {
+		if strings.EqualFold(glossary.Get("name").String(), r.Glossary) &&
+			strings.EqualFold(glossary.Get("target_lang").String(), targetLang) &&
+			(sourceLang == "auto" || strings.EqualFold(glossary.Get("source_lang").String(), sourceLang)) {
+			return glossary, nil
+		}
+	}
+	return gjson.Result{}, &Error{Kind: ErrGlossaryNotFound, Method: "v2/glossaries", Message: fmt.Sprintf("no glossary %q to %s", r.Glossary, strings.ToUpper(r.TargetLang))}
+}
+
+// checkOfficialResponse turns an official API response into an *Error if it reports a failure,
+// on top of the provider statuses the API answers 456 once the character quota is used up
+func checkOfficialResponse(statusCode int, body []byte) error {
+	const method = "v2/translate"
+	message := gjson.GetBytes(body, "message").String()
+	if statusCode == statusQuotaExceeded {
+		if message == "" {
+			message = "quota exceeded"
+		}
+		return &Error{Kind: ErrRateLimited, Method: method, StatusCode: statusCode, Message: message}
+	}
+	if err := statusError(method, statusCode, message); err != nil {
+		return err
+	}
+	if !gjson.GetBytes(body, "translations.0.text").Exists() {
+		return &Error{Kind: ErrUpstreamProtocol, Method: method, StatusCode: statusCode, Message: "response has no translations"}
+	}
+	return nil
+}
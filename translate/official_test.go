@@ -0,0 +1,182 @@
+package translate_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OwO-Network/DeepLX/translate"
+	"github.com/OwO-Network/DeepLX/translate/deepltest"
+)
+
+// newOfficialServer stands in for the official /v2/translate endpoint, it answers
+// with status and message when status is not 200. Like the API it rejects "auto"
+// and regional variants as source language.
+func newOfficialServer(t *testing.T, status int, message string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/translate" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "DeepL-Auth-Key test-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"message": message})
+			return
+		}
+		var body struct {
+			Text       []string `json:"text"`
+			SourceLang *string  `json:"source_lang"`
+			TargetLang string   `json:"target_lang"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Text) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.SourceLang != nil {
+			if lang, ok := translate.LookupLanguage(*body.SourceLang); !ok || !lang.Source || strings.Contains(lang.Code, "-") {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"message": "Value for 'source_lang' not supported."})
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"translations": []map[string]string{{
+			"detected_source_language": "EN",
+			"text":                     "<" + body.TargetLang + "> " + body.Text[0],
+		}}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOfficialClient(t *testing.T) {
+	server := newOfficialServer(t, http.StatusOK, "")
+	client, err := translate.NewOfficialClient("test-key", translate.WithProviderBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.TranslateContext(context.Background(), translate.Request{TargetLang: "de", Text: "Hello"})
+	if err != nil {
+		t.Fatalf("TranslateContext: %v", err)
+	}
+	if result.Data != "<DE> Hello" || result.SourceLang != "EN" || result.TargetLang != "DE" || result.Method != "Official" {
+		t.Errorf("result = %+v", result)
+	}
+
+	// Bob and Immersive Translate send auto, the API only takes an omitted source language
+	for _, sourceLang := range []string{"auto", "AUTO", "EN-GB", "en"} {
+		if _, err := client.TranslateContext(context.Background(), translate.Request{SourceLang: sourceLang, TargetLang: "DE", Text: "Hello"}); err != nil {
+			t.Errorf("source %q: %v", sourceLang, err)
+		}
+	}
+
+	if _, err := client.TranslateContext(context.Background(), translate.Request{TargetLang: "DE"}); !errors.Is(err, translate.ErrEmptyText) {
+		t.Errorf("empty text: err = %v", err)
+	}
+	if _, err := translate.NewOfficialClient(""); err == nil {
+		t.Error("NewOfficialClient accepted an empty key")
+	}
+}
+
+func TestOfficialClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		want    error
+	}{
+		{"forbidden", http.StatusForbidden, "Forbidden", translate.ErrAuthKeyInvalid},
+		{"quota", 456, "Quota exceeded", translate.ErrRateLimited},
+		{"too many requests", http.StatusTooManyRequests, "", translate.ErrRateLimited},
+		{"language", http.StatusBadRequest, "Value for 'target_lang' not supported.", translate.ErrUnsupportedLanguage},
+		{"server", http.StatusInternalServerError, "", translate.ErrUpstreamProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newOfficialServer(t, tt.status, tt.message)
+			client, err := translate.NewOfficialClient("test-key", translate.WithProviderBaseURL(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = client.TranslateContext(context.Background(), translate.Request{TargetLang: "DE", Text: "Hello"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallback(t *testing.T) {
+	web, server := newTestClient(t, noRetry)
+	official, err := translate.NewOfficialClient("test-key", translate.WithProviderBaseURL(newOfficialServer(t, http.StatusOK, "").URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := translate.Fallback{web, official}
+
+	result, err := chain.TranslateContext(context.Background(), translate.Request{TargetLang: "DE", Text: "Hello"})
+	if err != nil || result.Method != "Free" {
+		t.Fatalf("healthy web client: result = %+v, err = %v", result, err)
+	}
+
+	server.FailNext("LMT_split_text", deepltest.RateLimited)
+	result, err = chain.TranslateContext(context.Background(), translate.Request{TargetLang: "DE", Text: "Hello"})
+	if err != nil || result.Method != "Official" || result.Data != "<DE> Hello" {
+		t.Errorf("rate limited web client: result = %+v, err = %v", result, err)
+	}
+
+	if _, err := chain.TranslateContext(context.Background(), translate.Request{TargetLang: "DE"}); !errors.Is(err, translate.ErrEmptyText) {
+		t.Errorf("empty text: err = %v", err)
+	}
+
+	rejected, err := translate.NewOfficialClient("wrong-key", translate.WithProviderBaseURL(newOfficialServer(t, http.StatusOK, "").URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.FailNext("LMT_split_text", deepltest.RateLimited)
+	_, err = translate.Fallback{web, rejected}.TranslateContext(context.Background(), translate.Request{TargetLang: "DE", Text: "Hello"})
+	if !errors.Is(err, translate.ErrAuthKeyInvalid) {
+		t.Errorf("every provider failing: err = %v, want the last one", err)
+	}
+}
+
+func TestOfficialClientGlossary(t *testing.T) {
+	var sent map[string]any
+	server := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/glossaries":
+			w.Write([]byte(`{"glossaries":[
+				{"glossary_id":"g-fr","name":"legal","source_lang":"en","target_lang":"fr"},
+				{"glossary_id":"g-de","name":"Legal","source_lang":"en","target_lang":"de"}]}`))
+		case "/v2/translate":
+			json.NewDecoder(r.Body).Decode(&sent)
+			w.Write([]byte(`{"translations":[{"detected_source_language":"EN","text":"Vertrag"}]}`))
+		}
+	})
+	client, err := translate.NewOfficialClient("test-key", translate.WithProviderBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.TranslateContext(context.Background(), translate.Request{TargetLang: "DE", Text: "contract", Context: "Terms of sale", Glossary: "legal"})
+	if err != nil {
+		t.Fatalf("TranslateContext: %v", err)
+	}
+	if sent["glossary_id"] != "g-de" || sent["source_lang"] != "EN" || sent["context"] != "Terms of sale" {
+		t.Errorf("request = %v", sent)
+	}
+
+	_, err = client.TranslateContext(context.Background(), translate.Request{TargetLang: "JA", Text: "contract", Glossary: "legal"})
+	if !errors.Is(err, translate.ErrGlossaryNotFound) {
+		t.Errorf("missing glossary: err = %v", err)
+	}
+}
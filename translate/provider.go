@@ -0,0 +1,199 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+// Translator is a translation provider. The web JSON-RPC Client, the OfficialClient and the
+// LibreTranslate, Google and LLM clients are Translators, each reports itself in the Method field.
+type Translator interface {
+	TranslateContext(ctx context.Context, r Request) (DeepLXTranslationResult, error)
+}
+
+// Fallback tries its providers in order until one succeeds
+type Fallback []Translator
+
+// TranslateContext returns the result of the first provider that succeeds, or the error of the last one.
+// Errors that another provider cannot fix, an empty text or a done context, are returned at once.
+// So is a rejected dl_session, the caller has to learn about it rather than be served by a paid API.
+func (f Fallback) TranslateContext(ctx context.Context, r Request) (DeepLXTranslationResult, error) {
+	if len(f) == 0 {
+		return DeepLXTranslationResult{}, errors.New("no translation provider configured")
+	}
+	var err error
+	for _, t := range f {
+		var result DeepLXTranslationResult
+		result, err = t.TranslateContext(ctx, r)
+		if err == nil {
+			return result, nil
+		}
+		if final(ctx, err) {
+			return DeepLXTranslationResult{}, err
+		}
+	}
+	return DeepLXTranslationResult{}, err
+}
+
+// final reports whether err ends a Fallback instead of moving on to the next provider
+func final(ctx context.Context, err error) bool {
+	return errors.Is(err, ErrEmptyText) || errors.Is(err, ErrSessionInvalid) || ctx.Err() != nil
+}
+
+// StreamTranslator is a Translator that hands out its translation piece by piece
+// while it progresses, see Client.TranslateStream
+type StreamTranslator interface {
+	Translator
+	TranslateStream(ctx context.Context, r Request, emit func(delta string) error) (DeepLXTranslationResult, error)
+}
+
+// TranslateStream translates r with t and passes the translation to emit, piece by piece
+// if t is a StreamTranslator and all at once otherwise
+func TranslateStream(ctx context.Context, t Translator, r Request, emit func(delta string) error) (DeepLXTranslationResult, error) {
+	if s, ok := t.(StreamTranslator); ok {
+		return s.TranslateStream(ctx, r, emit)
+	}
+	result, err := t.TranslateContext(ctx, r)
+	if err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+	if err := emit(result.Data); err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+	return result, nil
+}
+
+// TranslateStream is like TranslateContext, but once a provider has emitted
+// part of its translation its error is returned rather than starting over
+func (f Fallback) TranslateStream(ctx context.Context, r Request, emit func(delta string) error) (DeepLXTranslationResult, error) {
+	if len(f) == 0 {
+		return DeepLXTranslationResult{}, errors.New("no translation provider configured")
+	}
+	var err error
+	for _, t := range f {
+		emitted := false
+		var result DeepLXTranslationResult
+		result, err = TranslateStream(ctx, t, r, func(delta string) error {
+			emitted = true
+			return emit(delta)
+		})
+		if err == nil {
+			return result, nil
+		}
+		if emitted || final(ctx, err) {
+			return DeepLXTranslationResult{}, err
+		}
+	}
+	return DeepLXTranslationResult{}, err
+}
+
+// ProviderOption configures the HTTP client of the official API, LibreTranslate, Google and LLM providers
+type ProviderOption func(*providerClient) error
+
+// providerClient is the HTTP client shared by the providers that speak plain JSON over HTTP
+type providerClient struct {
+	httpClient *req.Client
+	baseURL    string
+}
+
+// WithProviderBaseURL overrides the endpoint of the provider
+func WithProviderBaseURL(baseURL string) ProviderOption {
+	return func(c *providerClient) error {
+		if baseURL != "" {
+			c.baseURL = strings.TrimSuffix(baseURL, "/")
+		}
+		return nil
+	}
+}
+
+// WithProviderProxy routes requests through the given proxy URL
+func WithProviderProxy(proxyURL string) ProviderOption {
+	return func(c *providerClient) error {
+		if proxyURL == "" {
+			return nil
+		}
+		if _, err := parseProxyURL(proxyURL); err != nil {
+			return err
+		}
+		c.httpClient.SetProxyURL(proxyURL)
+		return nil
+	}
+}
+
+// WithProviderTimeout bounds every request
+func WithProviderTimeout(timeout time.Duration) ProviderOption {
+	return func(c *providerClient) error {
+		c.httpClient.SetTimeout(timeout)
+		return nil
+	}
+}
+
+func newProviderClient(baseURL string, opts []ProviderOption) (providerClient, error) {
+	c := providerClient{httpClient: req.C(), baseURL: strings.TrimSuffix(baseURL, "/")}
+	for _, opt := range opts {
+		if err := opt(&c); err != nil {
+			return providerClient{}, err
+		}
+	}
+	if c.baseURL == "" {
+		return providerClient{}, errors.New("provider endpoint is empty")
+	}
+	return c, nil
+}
+
+// send performs r and returns the response body. A failed request is returned as
+// ctx.Err() when the caller gave up, HTTP failures as an *Error built by classify.
+func (c providerClient) send(ctx context.Context, r *req.Request, method, url string, classify func(statusCode int, body []byte) error) ([]byte, error) {
+	resp, err := r.SetContext(ctx).Send(method, url)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	data := resp.Bytes()
+	if err := classify(resp.StatusCode, data); err != nil {
+		if upstreamErr, ok := err.(*Error); ok {
+			upstreamErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// statusError maps the HTTP status of a failed provider response to an *Error, nil below 400
+func statusError(method string, statusCode int, message string) error {
+	var kind error
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		kind = ErrAuthKeyInvalid
+	case statusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(message), "lang"):
+		kind = ErrUnsupportedLanguage
+	case statusCode >= http.StatusBadRequest:
+		kind = ErrUpstreamProtocol
+		if message == "" {
+			message = http.StatusText(statusCode)
+		}
+	default:
+		return nil
+	}
+	return &Error{Kind: kind, Method: method, StatusCode: statusCode, Message: message}
+}
+
+// isoLang turns a DeepL language code such as "EN-GB" into the ISO 639-1 code most
+// engines expect, "" becomes "auto"
+func isoLang(lang string) string {
+	lang = strings.ToLower(lang)
+	if lang == "" {
+		return "auto"
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	return base
+}
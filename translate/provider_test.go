@@ -0,0 +1,147 @@
+package translate_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OwO-Network/DeepLX/translate"
+)
+
+func newStandIn(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLibreClient(t *testing.T) {
+	server := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.URL.Path != "/translate":
+			http.NotFound(w, r)
+		case body["api_key"] != "secret":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"Invalid API key"}`))
+		case body["target"] == "xx":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"xx is not supported as target language"}`))
+		default:
+			json.NewEncoder(w).Encode(map[string]any{
+				"translatedText":   body["source"] + ">" + body["target"] + " " + body["q"],
+				"detectedLanguage": map[string]any{"language": "en", "confidence": 90},
+			})
+		}
+	})
+	client, err := translate.NewLibreClient(server.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.TranslateContext(context.Background(), translate.Request{TargetLang: "EN-GB", Text: "Hallo"})
+	if err != nil {
+		t.Fatalf("TranslateContext: %v", err)
+	}
+	if result.Data != "auto>en Hallo" || result.SourceLang != "EN" || result.TargetLang != "EN-GB" || result.Method != "LibreTranslate" {
+		t.Errorf("result = %+v", result)
+	}
+
+	if _, err := client.TranslateContext(context.Background(), translate.Request{TargetLang: "XX", Text: "Hallo"}); !errors.Is(err, translate.ErrUnsupportedLanguage) {
+		t.Errorf("unsupported language: err = %v", err)
+	}
+	rejected, _ := translate.NewLibreClient(server.URL, "wrong")
+	if _, err := rejected.TranslateContext(context.Background(), translate.Request{TargetLang: "DE", Text: "Hallo"}); !errors.Is(err, translate.ErrAuthKeyInvalid) {
+		t.Errorf("wrong key: err = %v", err)
+	}
+	if _, err := translate.NewLibreClient("", ""); err == nil {
+		t.Error("NewLibreClient accepted an empty URL")
+	}
+}
+
+func TestGoogleClient(t *testing.T) {
+	server := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path != "/translate_a/single" || query.Get("client") != "gtx":
+			http.NotFound(w, r)
+		case r.FormValue("q") == "busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			// Sentences come back one array each, the detected language is the third element
+			sentences := [][]string{}
+			for _, s := range strings.SplitAfter(r.FormValue("q"), ". ") {
+				sentences = append(sentences, []string{"[" + query.Get("tl") + "] " + s, s})
+			}
+			json.NewEncoder(w).Encode([]any{sentences, nil, query.Get("sl") + "-detected"})
+		}
+	})
+	client, err := translate.NewGoogleClient(translate.WithProviderBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.TranslateContext(context.Background(), translate.Request{SourceLang: "en", TargetLang: "ZH", Text: "One. Two."})
+	if err != nil {
+		t.Fatalf("TranslateContext: %v", err)
+	}
+	if result.Data != "[zh-CN] One. [zh-CN] Two." || result.SourceLang != "EN-DETECTED" || result.Method != "Google" {
+		t.Errorf("result = %+v", result)
+	}
+
+	if _, err := client.TranslateContext(context.Background(), translate.Request{TargetLang: "DE", Text: "busy"}); !errors.Is(err, translate.ErrRateLimited) {
+		t.Errorf("rate limited: err = %v", err)
+	}
+}
+
+func TestLLMClient(t *testing.T) {
+	var prompt string
+	server := newStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"Incorrect API key provided"}}`))
+			return
+		}
+		var body struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Model != "test-model" || len(body.Messages) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		prompt = body.Messages[0].Content
+		json.NewEncoder(w).Encode(map[string]any{"choices": []any{
+			map[string]any{"message": map[string]string{"role": "assistant", "content": " Bonjour\n"}},
+		}})
+	})
+	client, err := translate.NewLLMClient(server.URL+"/v1", "sk-test", "test-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.TranslateContext(context.Background(), translate.Request{SourceLang: "en", TargetLang: "fr", Text: "Hello"})
+	if err != nil {
+		t.Fatalf("TranslateContext: %v", err)
+	}
+	if result.Data != "Bonjour" || result.TargetLang != "FR" || result.Method != "LLM" {
+		t.Errorf("result = %+v", result)
+	}
+	if !strings.Contains(prompt, "from language code EN to language code FR") {
+		t.Errorf("system prompt = %q", prompt)
+	}
+
+	rejected, _ := translate.NewLLMClient(server.URL+"/v1", "sk-wrong", "test-model")
+	if _, err := rejected.TranslateContext(context.Background(), translate.Request{TargetLang: "FR", Text: "Hello"}); !errors.Is(err, translate.ErrAuthKeyInvalid) {
+		t.Errorf("wrong key: err = %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultProxyEjection is how long a failing proxy is taken out of rotation
+	defaultProxyEjection = time.Minute
+	// defaultProxyMaxFailures is the number of consecutive connection failures that eject a proxy
+	defaultProxyMaxFailures = 3
+)
+
+// parseProxyURL checks that rawURL is an http, https or socks5 proxy
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", u.Redacted())
+	}
+	return u, nil
+}
+
+// ProxyStatus is the health of a pooled proxy
+type ProxyStatus string
+
+const (
+	ProxyActive  ProxyStatus = "active"
+	ProxyEjected ProxyStatus = "ejected"
+)
+
+// ProxyState describes a pooled proxy, credentials in its URL are redacted
+type ProxyState struct {
+	Proxy        string      `json:"proxy"`
+	Status       ProxyStatus `json:"status"`
+	Requests     int         `json:"requests"`
+	Failures     int         `json:"failures"`
+	LastUsed     *time.Time  `json:"last_used,omitempty"`
+	EjectedUntil *time.Time  `json:"ejected_until,omitempty"`
+	LastError    string      `json:"last_error,omitempty"`
+}
+
+type pooledProxy struct {
+	url          *url.URL
+	requests     int
+	failures     int
+	consecutive  int
+	lastUsed     time.Time
+	ejectedUntil time.Time
+	lastError    string
+}
+
+// ProxyPool spreads upstream requests across egress proxies. Proxies that fail to connect
+// or get rate limited are ejected for a while. It is safe for concurrent use.
+type ProxyPool struct {
+	mu          sync.Mutex
+	proxies     []*pooledProxy
+	strategy    RotationStrategy
+	ejection    time.Duration
+	maxFailures int
+	next        int
+	now         func() time.Time
+}
+
+// NewProxyPool creates a pool of proxies, a failing proxy is ejected for ejection.
+// A zero ejection uses one minute.
+func NewProxyPool(proxyURLs []string, strategy RotationStrategy, ejection time.Duration) (*ProxyPool, error) {
+	if ejection <= 0 {
+		ejection = defaultProxyEjection
+	}
+	p := &ProxyPool{strategy: strategy, ejection: ejection, maxFailures: defaultProxyMaxFailures, now: time.Now}
+	for _, rawURL := range proxyURLs {
+		u, err := parseProxyURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, &pooledProxy{url: u})
+	}
+	if len(p.proxies) == 0 {
+		return nil, errors.New("proxy pool needs at least one proxy")
+	}
+	return p, nil
+}
+
+// pick returns the index of the proxy for the next request without counting it as used.
+// Proxies for which avoid reports true are only picked when no other is active, and when
+// every proxy is ejected the one due back first is used rather than failing the request.
+func (p *ProxyPool) pick(avoid func(i int) bool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	active := func(i int) bool { return !now.Before(p.proxies[i].ejectedUntil) }
+	lastUsed := func(i int) time.Time { return p.proxies[i].lastUsed }
+	i := p.strategy.pick(len(p.proxies), &p.next, func(i int) bool { return active(i) && (avoid == nil || !avoid(i)) }, lastUsed)
+	if i < 0 {
+		i = p.strategy.pick(len(p.proxies), &p.next, active, lastUsed)
+	}
+	if i < 0 {
+		i = 0
+		for j, proxy := range p.proxies {
+			if proxy.ejectedUntil.Before(p.proxies[i].ejectedUntil) {
+				i = j
+			}
+		}
+	}
+	return i
+}
+
+// use counts a request made through proxy i
+func (p *ProxyPool) use(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.proxies[i].requests++
+	p.proxies[i].lastUsed = p.now()
+}
+
+// report records the outcome of a request made through proxy i
+func (p *ProxyPool) report(i int, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proxy := p.proxies[i]
+	var upstreamErr *Error
+	switch {
+	case err == nil:
+		proxy.consecutive = 0
+		return
+	case errors.Is(err, ErrRateLimited):
+		// DeepL throttles by IP, the proxy is of no use until it cools down
+		proxy.ejectedUntil = p.now().Add(p.ejection)
+	case !errors.As(err, &upstreamErr):
+		// The request never got an answer: connection refused, TLS handshake, proxy error
+		proxy.consecutive++
+		if proxy.consecutive >= p.maxFailures {
+			proxy.consecutive = 0
+			proxy.ejectedUntil = p.now().Add(p.ejection)
+		}
+	default:
+		// DeepL answered, the proxy did its job
+		proxy.consecutive = 0
+		return
+	}
+	proxy.failures++
+	proxy.lastError = err.Error()
+}
+
+// States returns the state of every proxy in the order they were given
+func (p *ProxyPool) States() []ProxyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	states := make([]ProxyState, len(p.proxies))
+	for i, proxy := range p.proxies {
+		state := ProxyState{
+			Proxy:     proxy.url.Redacted(),
+			Status:    ProxyActive,
+			Requests:  proxy.requests,
+			Failures:  proxy.failures,
+			LastError: proxy.lastError,
+		}
+		if !proxy.lastUsed.IsZero() {
+			lastUsed := proxy.lastUsed
+			state.LastUsed = &lastUsed
+		}
+		if now.Before(proxy.ejectedUntil) {
+			state.Status = ProxyEjected
+			ejectedUntil := proxy.ejectedUntil
+			state.EjectedUntil = &ejectedUntil
+		}
+		states[i] = state
+	}
+	return states
+}
@@ -0,0 +1,102 @@
+package translate
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// defaultRedisPrefix namespaces the keys written by RedisCache
+	defaultRedisPrefix = "deeplx:"
+	// redisTimeout bounds the lookup or store of the lines of a request so a slow server does not stall translations
+	redisTimeout = 500 * time.Millisecond
+)
+
+// RedisCache stores line translations in a Redis compatible server so that
+// several DeepLX instances share them. Errors are reported as misses.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisCache connects to the server at rawURL, for example redis://:password@localhost:6379/0.
+// Entries expire after ttl, a zero ttl keeps them until Redis evicts them.
+func NewRedisCache(rawURL string, ttl time.Duration) (*RedisCache, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return &RedisCache{client: client, prefix: defaultRedisPrefix, ttl: ttl}, nil
+}
+
+// Close closes the connections to the server
+func (r *RedisCache) Close() error {
+	return r.client.Close()
+}
+
+func (r *RedisCache) key(key CacheKey) string {
+	return r.prefix + hex.EncodeToString(memoryKey(key))
+}
+
+// GetMany looks up every key with a single MGET, keys missing or unreadable are misses
+func (r *RedisCache) GetMany(ctx context.Context, keys []CacheKey) []*CacheEntry {
+	found := make([]*CacheEntry, len(keys))
+	if len(keys) == 0 {
+		return found
+	}
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = r.key(key)
+	}
+	values, err := r.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return found
+	}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var entry CacheEntry
+		if err := json.Unmarshal([]byte(data), &entry); err == nil {
+			found[i] = &entry
+		}
+	}
+	return found
+}
+
+// SetMany stores the translations in a single pipeline
+func (r *RedisCache) SetMany(ctx context.Context, keys []CacheKey, entries []CacheEntry) {
+	if len(keys) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	pipe := r.client.Pipeline()
+	for i, key := range keys {
+		data, err := json.Marshal(entries[i])
+		if err != nil {
+			continue
+		}
+		pipe.Set(ctx, r.key(key), data, r.ttl)
+	}
+	pipe.Exec(ctx)
+}
@@ -0,0 +1,97 @@
+package translate_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OwO-Network/DeepLX/translate"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisCache(t *testing.T, addr string, ttl time.Duration) *translate.RedisCache {
+	t.Helper()
+	cache, err := translate.NewRedisCache("redis://"+addr+"/0", ttl)
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestRedisCacheSharedBetweenClients(t *testing.T) {
+	mr := miniredis.RunT(t)
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "One\nTwo"}
+
+	// Two replicas, each with its own connection to the same server
+	first, _ := newTestClient(t, translate.WithCache(newTestRedisCache(t, mr.Addr(), time.Hour)))
+	if _, err := first.Translate(req); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if n := len(mr.Keys()); n != 2 {
+		t.Errorf("redis keys = %d, want 2", n)
+	}
+	if ttl := mr.TTL(mr.Keys()[0]); ttl != time.Hour {
+		t.Errorf("TTL = %v, want 1h", ttl)
+	}
+
+	second, server := newTestClient(t, translate.WithCache(newTestRedisCache(t, mr.Addr(), time.Hour)))
+	result, err := second.Translate(req)
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Data != "[DE] One\n[DE] Two" || result.CacheHits != 2 || server.CallCount("") != 0 {
+		t.Errorf("result = %+v, upstream calls = %d", result, server.CallCount(""))
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if result, _ := second.Translate(req); result.CacheMisses != 2 {
+		t.Errorf("after expiry: hits, misses = %d, %d", result.CacheHits, result.CacheMisses)
+	}
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := newTestRedisCache(t, mr.Addr(), 0)
+	client, _ := newTestClient(t, translate.WithCache(cache))
+
+	// Losing the cache only costs the hits, translations still succeed
+	addr := mr.Addr()
+	mr.Close()
+	result, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+	if err != nil || result.Data != "[DE] Hello" || result.CacheMisses != 1 {
+		t.Errorf("Translate = %+v, %v", result, err)
+	}
+
+	if _, err := translate.NewRedisCache("redis://"+addr, 0); err == nil {
+		t.Error("NewRedisCache connected to a stopped server")
+	}
+}
+
+func TestRedisCacheBatch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := newTestRedisCache(t, mr.Addr(), 0)
+	keys := []translate.CacheKey{
+		{SourceLang: "EN", TargetLang: "DE", Text: "One"},
+		{SourceLang: "EN", TargetLang: "DE", Text: "Two"},
+		{SourceLang: "EN", TargetLang: "DE", Text: "Three"},
+	}
+	cache.SetMany(context.Background(), keys[:2], []translate.CacheEntry{{Text: "Eins"}, {Text: "Zwei"}})
+
+	// All the lines of a request take a single round trip
+	commands := mr.CommandCount()
+	found := cache.GetMany(context.Background(), keys)
+	if found[0] == nil || found[0].Text != "Eins" || found[1] == nil || found[1].Text != "Zwei" || found[2] != nil {
+		t.Errorf("GetMany = %v", found)
+	}
+	if n := mr.CommandCount() - commands; n != 1 {
+		t.Errorf("lookup took %d commands, want 1", n)
+	}
+
+	// The caller giving up stops the lookup
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if found := cache.GetMany(ctx, keys); found[0] != nil {
+		t.Errorf("cancelled lookup = %v", found)
+	}
+}
@@ -0,0 +1,104 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy decides how often a failed upstream call is attempted again
+type RetryPolicy struct {
+	MaxAttempts int           // attempts including the first one, 1 disables retries
+	BaseDelay   time.Duration // backoff before the first retry, doubled for every further one
+	MaxDelay    time.Duration // upper bound of the backoff, a longer Retry-After is not waited for
+}
+
+// DefaultRetryPolicy is used for methods without a policy of their own
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("retry policy needs at least one attempt, got %d", p.MaxAttempts)
+	}
+	if p.BaseDelay < 0 || p.MaxDelay < 0 {
+		return errors.New("retry policy delays must not be negative")
+	}
+	return nil
+}
+
+// backoff returns the delay before retry n (starting at 1): exponential with equal jitter
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay << (n - 1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryable reports whether err may go away when the call is made again
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var upstreamErr *Error
+	if !errors.As(err, &upstreamErr) {
+		// Connection reset, TLS or proxy failure
+		return true
+	}
+	if upstreamErr.Method == "" {
+		// Raised locally, e.g. every pooled session is cooling down
+		return false
+	}
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return true
+	case errors.Is(err, ErrUpstreamProtocol):
+		// 5xx, truncated or garbled bodies; a 4xx will not change
+		return upstreamErr.StatusCode < 400 || upstreamErr.StatusCode >= 500
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// attemptsKey carries the counter of upstream attempts made for a translation
+type attemptsKey struct{}
+
+func withAttempts(ctx context.Context) (context.Context, *atomic.Int32) {
+	attempts := new(atomic.Int32)
+	return context.WithValue(ctx, attemptsKey{}, attempts), attempts
+}
+
+func countAttempt(ctx context.Context) {
+	if attempts, ok := ctx.Value(attemptsKey{}).(*atomic.Int32); ok {
+		attempts.Add(1)
+	}
+}
+
+// retryPolicy returns the policy of a JSON-RPC method
+func (c *Client) retryPolicy(method string) RetryPolicy {
+	if policy, ok := c.methodRetry[method]; ok {
+		return policy
+	}
+	return c.retry
+}
@@ -0,0 +1,63 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 6: time.Second, 80: time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(n); d < want/2 || d > want {
+				t.Errorf("backoff(%d) = %v, want within [%v, %v]", n, d, want/2, want)
+			}
+		}
+	}
+	if d := (RetryPolicy{MaxAttempts: 2}).backoff(1); d != 0 {
+		t.Errorf("backoff without delays = %v", d)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection reset by peer"), true},
+		{&Error{Kind: ErrRateLimited, Method: "LMT_handle_jobs"}, true},
+		{&Error{Kind: ErrUpstreamProtocol, Method: "LMT_handle_jobs", StatusCode: http.StatusBadGateway}, true},
+		{&Error{Kind: ErrUpstreamProtocol, Method: "LMT_handle_jobs", StatusCode: http.StatusOK, Message: "unexpected EOF"}, true},
+		{&Error{Kind: ErrUpstreamProtocol, Method: "LMT_handle_jobs", StatusCode: http.StatusBadRequest}, false},
+		{&Error{Kind: ErrSessionInvalid, Method: "LMT_handle_jobs", StatusCode: http.StatusUnauthorized}, false},
+		{&Error{Kind: ErrUnsupportedLanguage, Method: "LMT_handle_jobs"}, false},
+		{&Error{Kind: ErrRateLimited, Message: "every dl_session is cooling down or invalid"}, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Mon, 01 Jan 2024 12:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Jan 2024 11:00:00 GMT": 0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package translate
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RotationStrategy decides which member of a SessionPool or ProxyPool serves the next request
+type RotationStrategy int
+
+const (
+	// RoundRobin uses the available members in turn
+	RoundRobin RotationStrategy = iota
+	// LeastRecentlyUsed uses the available member that has been idle the longest
+	LeastRecentlyUsed
+	// Random picks any available member
+	Random
+)
+
+// ParseRotationStrategy parses "round-robin", "lru" or "random", an empty string means RoundRobin
+func ParseRotationStrategy(s string) (RotationStrategy, error) {
+	switch s {
+	case "", "round-robin":
+		return RoundRobin, nil
+	case "lru":
+		return LeastRecentlyUsed, nil
+	case "random":
+		return Random, nil
+	}
+	return RoundRobin, fmt.Errorf("unknown rotation strategy %q, want round-robin, lru or random", s)
+}
+
+// pick returns the index of the member to use among n, or -1 when none is available.
+// next is the round robin position and is advanced past the picked member.
+func (s RotationStrategy) pick(n int, next *int, available func(i int) bool, lastUsed func(i int) time.Time) int {
+	picked := -1
+	switch s {
+	case LeastRecentlyUsed:
+		for i := 0; i < n; i++ {
+			if available(i) && (picked < 0 || lastUsed(i).Before(lastUsed(picked))) {
+				picked = i
+			}
+		}
+	case Random:
+		var candidates []int
+		for i := 0; i < n; i++ {
+			if available(i) {
+				candidates = append(candidates, i)
+			}
+		}
+		if len(candidates) > 0 {
+			picked = candidates[rand.IntN(len(candidates))]
+		}
+	default:
+		for i := 0; i < n; i++ {
+			if j := (*next + i) % n; available(j) {
+				picked = j
+				*next = (j + 1) % n
+				break
+			}
+		}
+	}
+	return picked
+}
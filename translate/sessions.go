@@ -0,0 +1,181 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultSessionCooldown is how long a rate limited session is benched
+const defaultSessionCooldown = 5 * time.Minute
+
+// SessionStatus is the health of a pooled session
+type SessionStatus string
+
+const (
+	SessionActive   SessionStatus = "active"
+	SessionCooldown SessionStatus = "cooldown"
+	// SessionInvalid sessions were rejected by DeepL and are not used again
+	SessionInvalid SessionStatus = "invalid"
+)
+
+// SessionState describes a pooled session, the session itself is masked
+type SessionState struct {
+	Session       string        `json:"session"`
+	Status        SessionStatus `json:"status"`
+	Requests      int           `json:"requests"`
+	Failures      int           `json:"failures"`
+	LastUsed      *time.Time    `json:"last_used,omitempty"`
+	CooldownUntil *time.Time    `json:"cooldown_until,omitempty"`
+	LastError     string        `json:"last_error,omitempty"`
+}
+
+type pooledSession struct {
+	session       string
+	invalid       bool
+	requests      int
+	failures      int
+	lastUsed      time.Time
+	cooldownUntil time.Time
+	lastError     string
+}
+
+// SessionPool rotates requests across several dl_session cookies and benches
+// the ones DeepL rate limits. It is safe for concurrent use.
+type SessionPool struct {
+	mu       sync.Mutex
+	sessions []*pooledSession
+	strategy RotationStrategy
+	cooldown time.Duration
+	next     int
+	now      func() time.Time
+}
+
+// NewSessionPool creates a pool of sessions, a rate limited session is benched for cooldown.
+// A zero cooldown uses five minutes.
+func NewSessionPool(sessions []string, strategy RotationStrategy, cooldown time.Duration) (*SessionPool, error) {
+	if len(sessions) == 0 {
+		return nil, errors.New("session pool needs at least one session")
+	}
+	if cooldown <= 0 {
+		cooldown = defaultSessionCooldown
+	}
+	p := &SessionPool{strategy: strategy, cooldown: cooldown, now: time.Now}
+	seen := make(map[string]bool)
+	for _, session := range sessions {
+		if session == "" || seen[session] {
+			continue
+		}
+		seen[session] = true
+		p.sessions = append(p.sessions, &pooledSession{session: session})
+	}
+	if len(p.sessions) == 0 {
+		return nil, errors.New("session pool needs at least one session")
+	}
+	return p, nil
+}
+
+func (s *pooledSession) available(now time.Time) bool {
+	return !s.invalid && !now.Before(s.cooldownUntil)
+}
+
+// pick returns the index of the session for the next request without counting it as used.
+// Sessions for which avoid reports true are only picked when no other is available.
+func (p *SessionPool) pick(avoid func(session string) bool) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	available := func(i int) bool { return p.sessions[i].available(now) }
+	lastUsed := func(i int) time.Time { return p.sessions[i].lastUsed }
+	i := p.strategy.pick(len(p.sessions), &p.next, func(i int) bool { return available(i) && (avoid == nil || !avoid(p.sessions[i].session)) }, lastUsed)
+	if i < 0 {
+		i = p.strategy.pick(len(p.sessions), &p.next, available, lastUsed)
+	}
+	if i >= 0 {
+		return i, nil
+	}
+	// Waiting only helps when a session is cooling down rather than rejected
+	for _, s := range p.sessions {
+		if !s.invalid {
+			return -1, &Error{Kind: ErrRateLimited, Message: "every dl_session is cooling down or invalid"}
+		}
+	}
+	return -1, &Error{Kind: ErrSessionInvalid, Message: "every dl_session is invalid"}
+}
+
+// use counts a request made with session i and returns it
+func (p *SessionPool) use(i int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sessions[i].requests++
+	p.sessions[i].lastUsed = p.now()
+	return p.sessions[i].session
+}
+
+// report records the outcome of a request made with session
+func (p *SessionPool) report(session string, err error) {
+	// Only DeepL's verdict on the session counts, not the caller giving up
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.sessions {
+		if s.session != session {
+			continue
+		}
+		switch {
+		case errors.Is(err, ErrSessionInvalid):
+			s.invalid = true
+		case errors.Is(err, ErrRateLimited):
+			s.cooldownUntil = p.now().Add(p.cooldown)
+		}
+		s.failures++
+		s.lastError = err.Error()
+		return
+	}
+}
+
+// States returns the state of every session in the order they were given
+func (p *SessionPool) States() []SessionState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	states := make([]SessionState, len(p.sessions))
+	for i, s := range p.sessions {
+		state := SessionState{
+			Session:   MaskSession(s.session),
+			Status:    SessionActive,
+			Requests:  s.requests,
+			Failures:  s.failures,
+			LastError: s.lastError,
+		}
+		if !s.lastUsed.IsZero() {
+			lastUsed := s.lastUsed
+			state.LastUsed = &lastUsed
+		}
+		switch {
+		case s.invalid:
+			state.Status = SessionInvalid
+		case now.Before(s.cooldownUntil):
+			state.Status = SessionCooldown
+			cooldownUntil := s.cooldownUntil
+			state.CooldownUntil = &cooldownUntil
+		}
+		states[i] = state
+	}
+	return states
+}
+
+// MaskSession keeps enough of a dl_session to tell it apart without leaking it
+func MaskSession(session string) string {
+	if len(session) <= 8 {
+		return "****"
+	}
+	return session[:4] + "****" + session[len(session)-4:]
+}
@@ -0,0 +1,106 @@
+package translate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func acquireAll(t *testing.T, p *SessionPool, n int) []string {
+	t.Helper()
+	var got []string
+	for i := 0; i < n; i++ {
+		i, err := p.pick(nil)
+		if err != nil {
+			t.Fatalf("pick: %v", err)
+		}
+		got = append(got, p.use(i))
+	}
+	return got
+}
+
+func TestSessionPoolRoundRobin(t *testing.T) {
+	p, err := NewSessionPool([]string{"a", "b", "c", "b", ""}, RoundRobin, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	if got := acquireAll(t, p, 4); got[0] != "a" || got[1] != "b" || got[2] != "c" || got[3] != "a" {
+		t.Errorf("sessions = %q", got)
+	}
+
+	p.report("b", &Error{Kind: ErrRateLimited})
+	p.report("c", &Error{Kind: ErrSessionInvalid})
+	if got := acquireAll(t, p, 2); got[0] != "a" || got[1] != "a" {
+		t.Errorf("with b cooling down and c invalid: sessions = %q", got)
+	}
+
+	states := p.States()
+	if states[1].Status != SessionCooldown || states[1].CooldownUntil == nil || states[2].Status != SessionInvalid {
+		t.Errorf("states = %+v", states)
+	}
+
+	// b is back after its cooldown, c stays out
+	now = now.Add(2 * time.Minute)
+	if got := acquireAll(t, p, 3); got[0] != "b" || got[1] != "a" || got[2] != "b" {
+		t.Errorf("after cooldown: sessions = %q", got)
+	}
+
+	// Waiting helps as long as a session is only cooling down
+	p.report("a", &Error{Kind: ErrRateLimited})
+	p.report("b", &Error{Kind: ErrSessionInvalid})
+	if _, err := p.pick(nil); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("a cooling down, b and c invalid: err = %v, want ErrRateLimited", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	p.report("a", &Error{Kind: ErrSessionInvalid})
+	if _, err := p.pick(nil); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("every session invalid: err = %v, want ErrSessionInvalid", err)
+	}
+}
+
+func TestSessionPoolLeastRecentlyUsed(t *testing.T) {
+	p, err := NewSessionPool([]string{"a", "b", "c"}, LeastRecentlyUsed, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	p.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	if got := acquireAll(t, p, 3); got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("sessions = %q", got)
+	}
+	p.report("a", &Error{Kind: ErrRateLimited})
+	if got := acquireAll(t, p, 2); got[0] != "b" || got[1] != "c" {
+		t.Errorf("sessions = %q", got)
+	}
+	if p.cooldown != defaultSessionCooldown {
+		t.Errorf("cooldown = %v", p.cooldown)
+	}
+}
+
+func TestSessionPoolStates(t *testing.T) {
+	if _, err := NewSessionPool([]string{"", ""}, RoundRobin, 0); err == nil {
+		t.Error("NewSessionPool accepted no sessions")
+	}
+
+	p, _ := NewSessionPool([]string{"0123456789abcdef", "short"}, RoundRobin, 0)
+	acquireAll(t, p, 1)
+	p.report("0123456789abcdef", errors.New("connection reset"))
+	states := p.States()
+	if states[0].Session != "0123****cdef" || states[1].Session != "****" {
+		t.Errorf("masked sessions = %q, %q", states[0].Session, states[1].Session)
+	}
+	if states[0].Status != SessionActive || states[0].Requests != 1 || states[0].Failures != 1 || states[0].LastError != "connection reset" {
+		t.Errorf("state = %+v", states[0])
+	}
+	if states[1].LastUsed != nil {
+		t.Errorf("unused session has LastUsed = %v", states[1].LastUsed)
+	}
+}
@@ -0,0 +1,154 @@
+package translate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// TranslateStream is like TranslateContext but translates one sentence at a time, as split by
+// LMT_split_text, and passes every piece of the translation to emit as soon as it is known:
+// sentences, the spaces between them and line breaks. Cached lines are emitted whole.
+// Concatenated, the pieces make up the Data of the result. An error returned by emit aborts
+// the translation and is returned as is. Identical streams are not coalesced.
+func (c *Client) TranslateStream(ctx context.Context, r Request, emit func(delta string) error) (DeepLXTranslationResult, error) {
+	if r.Text == "" {
+		return DeepLXTranslationResult{}, ErrEmptyText
+	}
+	if err := ctx.Err(); err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+	ctx, attempts := withAttempts(ctx)
+
+	textParts := strings.Split(r.Text, "\n")
+	var lines []int
+	var texts []string
+	for i, part := range textParts {
+		if strings.TrimSpace(part) != "" {
+			lines = append(lines, i)
+			texts = append(texts, part)
+		}
+	}
+
+	// Cached lines need no split, the others are split in a single request up front
+	langs := c.lineLangs(r, texts)
+	keys := make([]CacheKey, len(texts))
+	for i, text := range texts {
+		keys[i] = newCacheKey(langs[i], r.TargetLang, r.TagHandling, r.Formality, text)
+		keys[i].Context = strings.Join(r.contextBefore(), "\n")
+		keys[i].Beams = r.extraBeams()
+	}
+	cached := make([]*CacheEntry, len(texts))
+	if !r.NoCache {
+		cached = c.lookup(ctx, keys)
+	}
+	var pendingTexts []string
+	for i, text := range texts {
+		if cached[i] == nil {
+			pendingTexts = append(pendingTexts, text)
+		}
+	}
+	var cacheHits, cacheMisses int
+	if c.cache != nil || c.memory != nil {
+		cacheHits, cacheMisses = len(texts)-len(pendingTexts), len(pendingTexts)
+	}
+
+	var splitTexts []gjson.Result
+	var detected string
+	if len(pendingTexts) > 0 {
+		splitResult, err := c.splitText(ctx, pendingTexts, r.TagHandling == "html" || r.TagHandling == "xml")
+		if err != nil {
+			return DeepLXTranslationResult{}, err
+		}
+		splitTexts = splitResult.Get("result.texts").Array()
+		if len(splitTexts) != len(pendingTexts) {
+			return DeepLXTranslationResult{}, &Error{Kind: ErrUpstreamProtocol, Method: "LMT_split_text", Message: "response does not match the request"}
+		}
+		detected = strings.ToUpper(splitResult.Get("result.lang.detected").String())
+	}
+
+	translatedParts := make([]string, len(textParts))
+	allAlternatives := make([][]string, len(textParts))
+	sourceLangs := make([]string, len(textParts))
+	for i := range textParts {
+		allAlternatives[i] = []string{""}
+	}
+	i, pending := 0, 0 // next line of texts and of splitTexts
+	for part, line := range textParts {
+		if part > 0 {
+			if err := emit("\n"); err != nil {
+				return DeepLXTranslationResult{}, err
+			}
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var translation lineTranslation
+		if entry := cached[i]; entry != nil {
+			translation = lineTranslation{Text: entry.Text, Alternatives: entry.Alternatives, SourceLang: entry.SourceLang}
+			if err := emitNonEmpty(emit, translation.Text); err != nil {
+				return DeepLXTranslationResult{}, err
+			}
+		} else {
+			lang := langs[i]
+			switch {
+			case lang != "":
+			case detected != "":
+				lang = detected
+			default:
+				lang = detectLang(line)
+			}
+
+			var err error
+			translation, err = c.streamLine(ctx, r, lang, splitTexts[pending].Get("chunks").Array(), line, emit)
+			if err != nil {
+				return DeepLXTranslationResult{}, err
+			}
+			translation.SourceLang = lang
+			c.store(ctx, []CacheKey{keys[i]}, []CacheEntry{{Text: translation.Text, Alternatives: translation.Alternatives, SourceLang: lang}})
+			pending++
+		}
+		translatedParts[part] = translation.Text
+		allAlternatives[part] = translation.Alternatives
+		sourceLangs[part] = translation.SourceLang
+		i++
+	}
+
+	sourceLang := r.SourceLang
+	if len(lines) > 0 {
+		sourceLang = sourceLangs[lines[0]]
+	}
+	return c.newResult(r, sourceLang, sourceLangs, translatedParts, allAlternatives, cacheHits, cacheMisses, int(attempts.Load())), nil
+}
+
+// streamLine translates the sentences of a line with one LMT_handle_jobs request each
+// and emits them in order, separated by a space
+func (c *Client) streamLine(ctx context.Context, r Request, lang string, chunks []gjson.Result, text string, emit func(string) error) (lineTranslation, error) {
+	translations := make([]gjson.Result, len(chunks))
+	before := r.contextBefore()
+	for idx := range chunks {
+		result, err := c.handleJobs(ctx, lang, r, []Job{newJob(chunks, idx, 1, before, r.numBeams())}, []string{text})
+		if err != nil {
+			return lineTranslation{}, err
+		}
+		translations[idx] = result[0]
+
+		sentence := result[0].Get("beams.0.sentences.0.text").String()
+		if idx > 0 {
+			sentence = " " + sentence
+		}
+		if err := emitNonEmpty(emit, sentence); err != nil {
+			return lineTranslation{}, err
+		}
+	}
+	return mergeBeams(translations)
+}
+
+func emitNonEmpty(emit func(string) error, delta string) error {
+	if delta == "" {
+		return nil
+	}
+	return emit(delta)
+}
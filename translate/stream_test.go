@@ -0,0 +1,98 @@
+package translate_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OwO-Network/DeepLX/translate"
+	"github.com/OwO-Network/DeepLX/translate/deepltest"
+)
+
+func TestTranslateStream(t *testing.T) {
+	client, server := newTestClient(t, translate.WithCache(translate.NewMemoryCache(100, time.Hour)))
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "One. Two.\n\nThree."}
+
+	var deltas []string
+	result, err := client.TranslateStream(context.Background(), req, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	want := []string{"[DE] One.", " [DE] Two.", "\n", "\n", "[DE] Three."}
+	if strings.Join(deltas, "|") != strings.Join(want, "|") {
+		t.Errorf("deltas = %q, want %q", deltas, want)
+	}
+	if result.Data != strings.Join(deltas, "") || len(result.Alternatives) != 2 || result.CacheMisses != 2 {
+		t.Errorf("result = %+v", result)
+	}
+	// One split for the whole text, then one request per sentence
+	if split, jobs := server.CallCount("LMT_split_text"), server.CallCount("LMT_handle_jobs"); split != 1 || jobs != 3 {
+		t.Errorf("split, handle_jobs calls = %d, %d", split, jobs)
+	}
+
+	// The lines are cached and come back whole, matching the regular translation
+	deltas = nil
+	client.TranslateStream(context.Background(), req, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if want := []string{"[DE] One. [DE] Two.", "\n", "\n", "[DE] Three."}; strings.Join(deltas, "|") != strings.Join(want, "|") {
+		t.Errorf("cached deltas = %q, want %q", deltas, want)
+	}
+	full, err := client.Translate(req)
+	if err != nil || full.Data != result.Data {
+		t.Errorf("Translate = %q, %v, want %q", full.Data, err, result.Data)
+	}
+}
+
+func TestTranslateStreamAborted(t *testing.T) {
+	client, server := newTestClient(t, noRetry)
+	stop := errors.New("client went away")
+
+	_, err := client.TranslateStream(context.Background(), translate.Request{TargetLang: "DE", Text: "One. Two. Three."}, func(string) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("err = %v, want the error of emit", err)
+	}
+	if n := server.CallCount("LMT_handle_jobs"); n != 1 {
+		t.Errorf("handle_jobs calls = %d, want 1", n)
+	}
+}
+
+func TestFallbackStream(t *testing.T) {
+	web, server := newTestClient(t, noRetry)
+	official, err := translate.NewOfficialClient("test-key", translate.WithProviderBaseURL(newOfficialServer(t, http.StatusOK, "").URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := translate.Fallback{web, official}
+	collect := func() ([]string, error) {
+		var deltas []string
+		_, err := chain.TranslateStream(context.Background(), translate.Request{TargetLang: "DE", Text: "One. Two."}, func(delta string) error {
+			deltas = append(deltas, delta)
+			return nil
+		})
+		return deltas, err
+	}
+
+	// Nothing was emitted yet, the official API takes over with a single piece
+	server.FailNext("LMT_split_text", deepltest.RateLimited)
+	deltas, err := collect()
+	if err != nil || len(deltas) != 1 || deltas[0] != "<DE> One. Two." {
+		t.Errorf("before the first piece: deltas = %q, err = %v", deltas, err)
+	}
+
+	// Half a translation cannot be completed by another provider
+	server.RateLimitAfter(2)
+	deltas, err = collect()
+	if !errors.Is(err, translate.ErrRateLimited) || len(deltas) != 1 {
+		t.Errorf("after the first piece: deltas = %q, err = %v", deltas, err)
+	}
+}
@@ -14,71 +14,153 @@ package translate
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"strings"
-
-	"github.com/abadojack/whatlanggo"
-	"github.com/imroc/req/v3"
+	"time"
 
 	"github.com/andybalholm/brotli"
+	"github.com/imroc/req/v3"
 	"github.com/tidwall/gjson"
 )
 
-const baseURL = "https://www2.deepl.com/jsonrpc"
+// DefaultBaseURL is the DeepL JSON-RPC endpoint used unless WithBaseURL is given
+const DefaultBaseURL = "https://www2.deepl.com/jsonrpc"
+
+// makeRequest makes an HTTP request to DeepL API, transient failures are retried
+// with exponential backoff according to the retry policy of urlMethod
+func (c *Client) makeRequest(ctx context.Context, postData *PostData, urlMethod string) (gjson.Result, error) {
+	policy := c.retryPolicy(urlMethod)
+	for attempt := 1; ; attempt++ {
+		countAttempt(ctx)
+		result, err := c.limitedAttempt(ctx, postData, urlMethod)
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err) {
+			return result, err
+		}
 
-// makeRequest makes an HTTP request to DeepL API
+		wait := policy.backoff(attempt)
+		var upstreamErr *Error
+		if errors.As(err, &upstreamErr) && upstreamErr.RetryAfter > 0 {
+			if upstreamErr.RetryAfter > policy.MaxDelay {
+				// Holding the request that long is worse than failing it
+				return result, err
+			}
+			wait = max(wait, upstreamErr.RetryAfter)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return gjson.Result{}, ctx.Err()
+		}
+	}
+}
 
-func makeRequest(postData *PostData, urlMethod string, proxyURL string, dlSession string) (gjson.Result, error) {
-	urlFull := fmt.Sprintf("%s?client=chrome-extension,1.28.0&method=%s", baseURL, urlMethod)
+// limitedAttempt runs attempt once a slot of the Client is free, the slot is
+// not held while makeRequest backs off
+func (c *Client) limitedAttempt(ctx context.Context, postData *PostData, urlMethod string) (gjson.Result, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return gjson.Result{}, ctx.Err()
+	}
+	defer func() { <-c.slots }()
+	return c.attempt(ctx, postData, urlMethod)
+}
 
-	postStr := formatPostString(postData)
+// attempt makes a single request. Pooled clients use the next session of the
+// session pool, and every client the next proxy of the proxy pool. Members whose
+// circuit is open are passed over as long as the pools have others.
+func (c *Client) attempt(ctx context.Context, postData *PostData, urlMethod string) (gjson.Result, error) {
+	dlSession := c.dlSession
+	fromPool := dlSession == "" && c.pooled
+	session := -1
+	if fromPool {
+		var err error
+		if session, err = c.sessions.pick(c.sessionBlocked); err != nil {
+			return gjson.Result{}, err
+		}
+		dlSession = c.sessions.sessions[session].session
+	}
+	httpClient, proxy, proxyName := c.httpClient, -1, c.proxyName
+	if c.proxies != nil {
+		proxy = c.proxies.pick(func(i int) bool { return c.blocked(c.proxies.proxies[i].url.Redacted(), dlSession) })
+		httpClient, proxyName = c.proxyHTTP[proxy], c.proxies.proxies[proxy].url.Redacted()
+	}
 
-	// Create a new req client
-	client := req.C().SetTLSFingerprintRandomized()
-
-	// Set headers
-	headers := http.Header{
-		"Accept":          []string{"*/*"},
-		"Accept-Language": []string{"en-US,en;q=0.9,zh-CN;q=0.8,zh-TW;q=0.7,zh-HK;q=0.6,zh;q=0.5"},
-		"Authorization":   []string{"None"},
-		"Cache-Control":   []string{"no-cache"},
-		"Content-Type":    []string{"application/json"},
-		"DNT":             []string{"1"},
-		"Origin":          []string{"chrome-extension://cofdbpoegempjloogbagkncekinflcnj"},
-		"Pragma":          []string{"no-cache"},
-		"Priority":        []string{"u=1, i"},
-		"Referer":         []string{"https://www.deepl.com/"},
-		"Sec-Fetch-Dest":  []string{"empty"},
-		"Sec-Fetch-Mode":  []string{"cors"},
-		"Sec-Fetch-Site":  []string{"none"},
-		"Sec-GPC":         []string{"1"},
-		"User-Agent":      []string{"DeepLBrowserExtension/1.28.0 Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36"},
+	// An open circuit fails fast without counting against the session or proxy
+	identity := breakerIdentity{proxy: proxyName, session: dlSession}
+	if c.breakers != nil {
+		if err := c.breakers.allow(identity, urlMethod); err != nil {
+			return gjson.Result{}, err
+		}
+	}
+	if fromPool {
+		c.sessions.use(session)
+	}
+	if proxy >= 0 {
+		c.proxies.use(proxy)
 	}
 
-	if dlSession != "" {
-		headers.Set("Cookie", "dl_session="+dlSession)
+	result, err := c.doRequest(ctx, httpClient, postData, urlMethod, dlSession)
+	if c.breakers != nil {
+		c.breakers.record(identity, err)
+	}
+	if fromPool {
+		c.sessions.report(dlSession, err)
 	}
+	if proxy >= 0 {
+		c.proxies.report(proxy, err)
+	}
+	return result, err
+}
 
-	// Set proxy if provided
-	if proxyURL != "" {
-		proxy, err := url.Parse(proxyURL)
-		if err != nil {
-			return gjson.Result{}, err
+// blocked reports whether the circuit of the route through proxyName with dlSession rejects requests
+func (c *Client) blocked(proxyName, dlSession string) bool {
+	return c.breakers != nil && c.breakers.blocked(breakerIdentity{proxy: proxyName, session: dlSession})
+}
+
+// sessionBlocked reports whether every route of dlSession is behind an open circuit
+func (c *Client) sessionBlocked(dlSession string) bool {
+	if c.breakers == nil {
+		return false
+	}
+	if c.proxies == nil {
+		return c.blocked(c.proxyName, dlSession)
+	}
+	for _, proxy := range c.proxies.proxies {
+		if !c.blocked(proxy.url.Redacted(), dlSession) {
+			return false
 		}
-		client.SetProxyURL(proxy.String())
+	}
+	return true
+}
+
+func (c *Client) doRequest(ctx context.Context, httpClient *req.Client, postData *PostData, urlMethod string, dlSession string) (gjson.Result, error) {
+	urlFull := fmt.Sprintf("%s?client=chrome-extension,1.28.0&method=%s", c.baseURL, urlMethod)
+
+	postStr := formatPostString(postData)
+
+	headers := c.headers.Clone()
+	if dlSession != "" {
+		headers.Set("Cookie", "dl_session="+dlSession)
 	}
 
 	// Make the request
-	r := client.R()
+	r := httpClient.R().SetContext(ctx)
 	r.Headers = headers
 	resp, err := r.
 		SetBody(bytes.NewReader([]byte(postStr))).
 		Post(urlFull)
 
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return gjson.Result{}, ctxErr
+		}
 		return gjson.Result{}, err
 	}
 
@@ -91,13 +173,28 @@ func makeRequest(postData *PostData, urlMethod string, proxyURL string, dlSessio
 
 	body, err := io.ReadAll(bodyReader)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return gjson.Result{}, ctxErr
+		}
+		return gjson.Result{}, &Error{Kind: ErrUpstreamProtocol, Method: urlMethod, StatusCode: resp.StatusCode, Message: err.Error()}
+	}
+
+	if err := checkResponse(urlMethod, resp.StatusCode, dlSession != "", body); err != nil {
+		if upstreamErr, ok := err.(*Error); ok {
+			upstreamErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
 		return gjson.Result{}, err
 	}
 	return gjson.ParseBytes(body), nil
 }
 
-// splitText splits the input text for translation
-func splitText(text string, tagHandling bool, proxyURL string, dlSession string) (gjson.Result, error) {
+// splitText splits the input texts into sentences in a single request
+func (c *Client) splitText(ctx context.Context, texts []string, tagHandling bool) (gjson.Result, error) {
+	richText := tagHandling
+	for _, text := range texts {
+		richText = richText || isRichText(text)
+	}
+
 	postData := &PostData{
 		Jsonrpc: "2.0",
 		Method:  "LMT_split_text",
@@ -109,176 +206,426 @@ func splitText(text string, tagHandling bool, proxyURL string, dlSession string)
 			Lang: Lang{
 				LangUserSelected: "auto",
 			},
-			Texts:    []string{text},
-			TextType: map[bool]string{true: "richtext", false: "plaintext"}[tagHandling || isRichText(text)],
+			Texts:    texts,
+			TextType: map[bool]string{true: "richtext", false: "plaintext"}[richText],
 		},
 	}
 
-	return makeRequest(postData, "LMT_split_text", proxyURL, dlSession)
+	return c.makeRequest(ctx, postData, "LMT_split_text")
 }
 
-// TranslateByDeepLX performs translation using DeepL API
-func TranslateByDeepLX(sourceLang, targetLang, text string, tagHandling string, proxyURL string, dlSession string) (DeepLXTranslationResult, error) {
-	if text == "" {
-		return DeepLXTranslationResult{
-			Code:    http.StatusNotFound,
-			Message: "No text to translate",
-		}, nil
+// lookup returns the cached or memorised translation of every key, nil where neither has it.
+// Lines found in the translation memory are copied into the cache.
+func (c *Client) lookup(ctx context.Context, keys []CacheKey) []*CacheEntry {
+	found := make([]*CacheEntry, len(keys))
+	if c.cache != nil {
+		found = c.cache.GetMany(ctx, keys)
+	}
+	if c.memory != nil {
+		var memorisedKeys []CacheKey
+		var memorised []CacheEntry
+		for i, key := range keys {
+			if found[i] != nil {
+				continue
+			}
+			if entry, ok := c.memory.Get(key); ok {
+				found[i] = &entry
+				memorisedKeys, memorised = append(memorisedKeys, key), append(memorised, entry)
+			}
+		}
+		if c.cache != nil && len(memorisedKeys) > 0 {
+			c.cache.SetMany(ctx, memorisedKeys, memorised)
+		}
 	}
+	return found
+}
 
-	// Split text by newlines and store them for later reconstruction
-	textParts := strings.Split(text, "\n")
-	var translatedParts []string
-	var allAlternatives [][]string // Store alternatives for each part
+// store saves freshly translated lines in the cache and the translation memory
+func (c *Client) store(ctx context.Context, keys []CacheKey, entries []CacheEntry) {
+	if c.cache != nil {
+		c.cache.SetMany(ctx, keys, entries)
+	}
+	if c.memory != nil {
+		c.memory.SetMany(keys, entries)
+	}
+}
 
-	for _, part := range textParts {
-		if strings.TrimSpace(part) == "" {
-			translatedParts = append(translatedParts, "")
-			allAlternatives = append(allAlternatives, []string{""})
-			continue
-		}
+// lineTranslation is the translation of a single line and its alternatives
+type lineTranslation struct {
+	Text         string
+	Alternatives []string
+	SourceLang   string
+}
 
-		// Split text first
-		splitResult, err := splitText(part, tagHandling == "html" || tagHandling == "xml", proxyURL, dlSession)
-		if err != nil {
-			return DeepLXTranslationResult{
-				Code:    http.StatusServiceUnavailable,
-				Message: err.Error(),
-			}, nil
+// translateLines translates non-blank lines of r with one LMT_split_text request and
+// one LMT_handle_jobs request per source language. sourceLangs holds the language
+// of every line, empty entries use the language DeepL detected while splitting.
+func (c *Client) translateLines(ctx context.Context, r Request, sourceLangs []string, texts []string) ([]lineTranslation, error) {
+	// Split all lines in one request
+	splitResult, err := c.splitText(ctx, texts, r.TagHandling == "html" || r.TagHandling == "xml")
+	if err != nil {
+		return nil, err
+	}
+
+	splitTexts := splitResult.Get("result.texts").Array()
+	if len(splitTexts) != len(texts) {
+		return nil, &Error{Kind: ErrUpstreamProtocol, Method: "LMT_split_text", Message: "response does not match the request"}
+	}
+
+	// Fill in the languages left to DeepL, falling back to local detection
+	langs := make([]string, len(texts))
+	detected := strings.ToUpper(splitResult.Get("result.lang.detected").String())
+	for i := range texts {
+		switch {
+		case sourceLangs[i] != "":
+			langs[i] = sourceLangs[i]
+		case detected != "":
+			langs[i] = detected
+		default:
+			langs[i] = detectLang(texts[i])
 		}
+	}
 
-		// Get detected language if source language is auto
-		if sourceLang == "auto" || sourceLang == "" {
-			sourceLang = strings.ToUpper(whatlanggo.DetectLang(part).Iso6391())
+	// Lines in the same language share a LMT_handle_jobs request
+	var groupLangs []string
+	groups := make(map[string][]int)
+	for i, lang := range langs {
+		if _, ok := groups[lang]; !ok {
+			groupLangs = append(groupLangs, lang)
 		}
+		groups[lang] = append(groups[lang], i)
+	}
 
-		// Prepare jobs from split result
+	before := r.contextBefore()
+	lineResults := make([]lineTranslation, len(texts))
+	errs := forEach(ctx, len(groupLangs), len(groupLangs), true, func(ctx context.Context, g int) error {
+		lang := groupLangs[g]
+		group := groups[lang]
+
+		// Prepare jobs from split result, jobLines maps every job back to its line
 		var jobs []Job
-		chunks := splitResult.Get("result.texts.0.chunks").Array()
-		for idx, chunk := range chunks {
-			sentence := chunk.Get("sentences.0")
-
-			// Handle context
-			contextBefore := []string{}
-			contextAfter := []string{}
-			if idx > 0 {
-				contextBefore = []string{chunks[idx-1].Get("sentences.0.text").String()}
-			}
-			if idx < len(chunks)-1 {
-				contextAfter = []string{chunks[idx+1].Get("sentences.0.text").String()}
+		var jobLines []int
+		var groupTexts []string
+		for _, i := range group {
+			groupTexts = append(groupTexts, texts[i])
+			chunks := splitTexts[i].Get("chunks").Array()
+			for idx := range chunks {
+				jobs = append(jobs, newJob(chunks, idx, len(jobs)+1, before, r.numBeams()))
+				jobLines = append(jobLines, i)
 			}
+		}
 
-			jobs = append(jobs, Job{
-				Kind:               "default",
-				PreferredNumBeams:  4,
-				RawEnContextBefore: contextBefore,
-				RawEnContextAfter:  contextAfter,
-				Sentences: []Sentence{{
-					Prefix: sentence.Get("prefix").String(),
-					Text:   sentence.Get("text").String(),
-					ID:     idx + 1,
-				}},
-			})
+		translations, err := c.handleJobs(ctx, lang, r, jobs, groupTexts)
+		if err != nil {
+			return err
 		}
 
-		hasRegionalVariant := false
-		targetLangCode := targetLang
-		targetLangParts := strings.Split(targetLang, "-")
-		if len(targetLangParts) > 1 {
-			targetLangCode = targetLangParts[0]
-			hasRegionalVariant = true
+		// Group the translations of every line
+		lineTranslations := make(map[int][]gjson.Result, len(group))
+		for j, translation := range translations {
+			lineTranslations[jobLines[j]] = append(lineTranslations[jobLines[j]], translation)
 		}
 
-		// Prepare translation request
-		id := getRandomNumber()
-
-		postData := &PostData{
-			Jsonrpc: "2.0",
-			Method:  "LMT_handle_jobs",
-			ID:      id,
-			Params: Params{
-				CommonJobParams: CommonJobParams{
-					Mode: "translate",
-				},
-				Lang: Lang{
-					SourceLangComputed: strings.ToUpper(sourceLang),
-					TargetLang:         strings.ToUpper(targetLangCode),
-				},
-				Jobs:      jobs,
-				Priority:  1,
-				Timestamp: getTimeStamp(getICount(part)),
+		// Process translation results
+		for _, line := range group {
+			translation, err := mergeBeams(lineTranslations[line])
+			if err != nil {
+				return err
+			}
+			translation.SourceLang = lang
+			lineResults[line] = translation
+		}
+		return nil
+	})
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+
+	return lineResults, nil
+}
+
+// newJob builds the job translating the sentence of chunks[idx], its neighbours are given as context.
+// The first sentence of a line gets before, the context of the request.
+func newJob(chunks []gjson.Result, idx, id int, before []string, beams int) Job {
+	sentence := chunks[idx].Get("sentences.0")
+
+	// Handle context
+	contextBefore := []string{}
+	contextAfter := []string{}
+	if idx == 0 && len(before) > 0 {
+		contextBefore = before
+	}
+	if idx > 0 {
+		contextBefore = []string{chunks[idx-1].Get("sentences.0.text").String()}
+	}
+	if idx < len(chunks)-1 {
+		contextAfter = []string{chunks[idx+1].Get("sentences.0.text").String()}
+	}
+
+	return Job{
+		Kind:               "default",
+		PreferredNumBeams:  beams,
+		RawEnContextBefore: contextBefore,
+		RawEnContextAfter:  contextAfter,
+		Sentences: []Sentence{{
+			Prefix: sentence.Get("prefix").String(),
+			Text:   sentence.Get("text").String(),
+			ID:     id,
+		}},
+	}
+}
+
+// handleJobs sends the jobs in a single LMT_handle_jobs request and returns one translation per job
+func (c *Client) handleJobs(ctx context.Context, sourceLang string, r Request, jobs []Job, texts []string) ([]gjson.Result, error) {
+	targetLang := r.TargetLang
+	hasRegionalVariant := false
+	targetLangCode := targetLang
+	targetLangParts := strings.Split(targetLang, "-")
+	if len(targetLangParts) > 1 {
+		targetLangCode = targetLangParts[0]
+		hasRegionalVariant = true
+	}
+
+	// Prepare translation request
+	postData := &PostData{
+		Jsonrpc: "2.0",
+		Method:  "LMT_handle_jobs",
+		ID:      getRandomNumber(),
+		Params: Params{
+			CommonJobParams: CommonJobParams{
+				Mode:            "translate",
+				RegionalVariant: map[bool]string{true: targetLang, false: ""}[hasRegionalVariant],
+				Formality:       string(r.Formality),
 			},
+			Lang: Lang{
+				SourceLangComputed: strings.ToUpper(sourceLang),
+				TargetLang:         strings.ToUpper(targetLangCode),
+			},
+			Jobs:      jobs,
+			Priority:  1,
+			Timestamp: getTimeStamp(getICount(strings.Join(texts, "\n"))),
+		},
+	}
+
+	// Make translation request
+	result, err := c.makeRequest(ctx, postData, "LMT_handle_jobs")
+	if err != nil {
+		return nil, err
+	}
+
+	translations := result.Get("result.translations").Array()
+	if len(translations) != len(jobs) {
+		return nil, &Error{Kind: ErrUpstreamProtocol, Method: "LMT_handle_jobs", Message: "response has no translations"}
+	}
+	return translations, nil
+}
+
+// mergeBeams joins the translated sentences of a line, beam 0 is the translation
+// and the other beams make up the alternatives
+func mergeBeams(translations []gjson.Result) (lineTranslation, error) {
+	var partTranslation string
+	var partAlternatives []string
+
+	if len(translations) > 0 {
+		// Process main translation
+		for _, translation := range translations {
+			partTranslation += translation.Get("beams.0.sentences.0.text").String() + " "
 		}
+		partTranslation = strings.TrimSpace(partTranslation)
 
-		if hasRegionalVariant {
-			postData = &PostData{
-				Jsonrpc: "2.0",
-				Method:  "LMT_handle_jobs",
-				ID:      id,
-				Params: Params{
-					CommonJobParams: CommonJobParams{
-						Mode:            "translate",
-						RegionalVariant: map[bool]string{true: targetLang, false: ""}[hasRegionalVariant],
-					},
-					Lang: Lang{
-						SourceLangComputed: strings.ToUpper(sourceLang),
-						TargetLang:         strings.ToUpper(targetLangCode),
-					},
-					Jobs:      jobs,
-					Priority:  1,
-					Timestamp: getTimeStamp(getICount(part)),
-				},
+		// Process alternatives
+		numBeams := len(translations[0].Get("beams").Array())
+		for i := 1; i < numBeams; i++ { // Start from 1 since 0 is the main translation
+			var altText string
+			for _, translation := range translations {
+				beams := translation.Get("beams").Array()
+				if i < len(beams) {
+					altText += beams[i].Get("sentences.0.text").String() + " "
+				}
+			}
+			if altText != "" {
+				partAlternatives = append(partAlternatives, strings.TrimSpace(altText))
 			}
 		}
+	}
 
-		// Make translation request
-		result, err := makeRequest(postData, "LMT_handle_jobs", proxyURL, dlSession)
-		if err != nil {
-			return DeepLXTranslationResult{
-				Code:    http.StatusServiceUnavailable,
-				Message: err.Error(),
-			}, nil
+	if partTranslation == "" {
+		return lineTranslation{}, &Error{Kind: ErrUpstreamProtocol, Method: "LMT_handle_jobs", Message: "response has no translations"}
+	}
+	return lineTranslation{Text: partTranslation, Alternatives: partAlternatives}, nil
+}
+
+// TranslateByDeepLX performs translation using DeepL API.
+// Failures are returned as errors, see the Err* sentinels and *Error.
+func TranslateByDeepLX(sourceLang, targetLang, text string, tagHandling string, proxyURL string, dlSession string) (DeepLXTranslationResult, error) {
+	return TranslateByDeepLXContext(context.Background(), sourceLang, targetLang, text, tagHandling, proxyURL, dlSession)
+}
+
+// TranslateByDeepLXContext is like TranslateByDeepLX but aborts when ctx is done.
+// A cancelled or expired context is returned as a non-nil error that wraps ctx.Err().
+func TranslateByDeepLXContext(ctx context.Context, sourceLang, targetLang, text string, tagHandling string, proxyURL string, dlSession string) (DeepLXTranslationResult, error) {
+	client, err := defaultClient(proxyURL)
+	if err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+	return client.Session(dlSession).TranslateContext(ctx, Request{
+		SourceLang:  sourceLang,
+		TargetLang:  targetLang,
+		Text:        text,
+		TagHandling: tagHandling,
+	})
+}
+
+// Translate performs translation using DeepL API
+func (c *Client) Translate(r Request) (DeepLXTranslationResult, error) {
+	return c.TranslateContext(context.Background(), r)
+}
+
+// TranslateContext is like Translate but propagates ctx to every upstream call.
+// A cancelled or expired context is returned as a non-nil error that wraps ctx.Err().
+// Identical requests made while one is in flight wait for it and get the same result.
+func (c *Client) TranslateContext(ctx context.Context, r Request) (DeepLXTranslationResult, error) {
+	if c.flights == nil || r.Text == "" || ctx.Err() != nil {
+		return c.translate(ctx, r)
+	}
+	return c.flights.do(ctx, flightKey{Request: r, dlSession: c.dlSession, pooled: c.pooled}, func(ctx context.Context) (DeepLXTranslationResult, error) {
+		return c.translate(ctx, r)
+	})
+}
+
+func (c *Client) translate(ctx context.Context, r Request) (DeepLXTranslationResult, error) {
+	sourceLang, targetLang, text, tagHandling := r.SourceLang, r.TargetLang, r.Text, r.TagHandling
+	if text == "" {
+		return DeepLXTranslationResult{}, ErrEmptyText
+	}
+	if err := ctx.Err(); err != nil {
+		return DeepLXTranslationResult{}, err
+	}
+	ctx, attempts := withAttempts(ctx)
+
+	// Split text by newlines and store them for later reconstruction,
+	// blank lines are kept as they are and never sent upstream
+	textParts := strings.Split(text, "\n")
+	translatedParts := make([]string, len(textParts))
+	allAlternatives := make([][]string, len(textParts)) // Store alternatives for each part
+	var lines []int                                     // Indexes of the parts to translate
+	var texts []string
+	for i, part := range textParts {
+		if strings.TrimSpace(part) == "" {
+			allAlternatives[i] = []string{""}
+			continue
 		}
+		lines = append(lines, i)
+		texts = append(texts, part)
+	}
 
-		// Process translation results
-		var partTranslation string
-		var partAlternatives []string
+	sourceLangs := make([]string, len(textParts)) // Language of every line, empty for blank lines
+	var cacheHits, cacheMisses int
+	if len(texts) > 0 {
+		langs := c.lineLangs(r, texts)
+
+		// Look up every line in the cache at once, the others are left pending
+		translations := make([]lineTranslation, len(texts))
+		keys := make([]CacheKey, len(texts))
+		for i, text := range texts {
+			keys[i] = newCacheKey(langs[i], targetLang, tagHandling, r.Formality, text)
+			keys[i].Context = strings.Join(r.contextBefore(), "\n")
+			keys[i].Beams = r.extraBeams()
+		}
+		cached := make([]*CacheEntry, len(texts))
+		if !r.NoCache {
+			cached = c.lookup(ctx, keys)
+		}
+		var pending []int
+		for i, entry := range cached {
+			if entry != nil {
+				translations[i] = lineTranslation{Text: entry.Text, Alternatives: entry.Alternatives, SourceLang: entry.SourceLang}
+				continue
+			}
+			pending = append(pending, i)
+		}
+		if c.cache != nil || c.memory != nil {
+			cacheHits, cacheMisses = len(texts)-len(pending), len(pending)
+		}
 
-		translations := result.Get("result.translations").Array()
-		if len(translations) > 0 {
-			// Process main translation
-			for _, translation := range translations {
-				partTranslation += translation.Get("beams.0.sentences.0.text").String() + " "
+		if len(pending) > 0 {
+			pendingTexts := make([]string, len(pending))
+			pendingLangs := make([]string, len(pending))
+			for j, i := range pending {
+				pendingTexts[j], pendingLangs[j] = texts[i], langs[i]
 			}
-			partTranslation = strings.TrimSpace(partTranslation)
-
-			// Process alternatives
-			numBeams := len(translations[0].Get("beams").Array())
-			for i := 1; i < numBeams; i++ { // Start from 1 since 0 is the main translation
-				var altText string
-				for _, translation := range translations {
-					beams := translation.Get("beams").Array()
-					if i < len(beams) {
-						altText += beams[i].Get("sentences.0.text").String() + " "
-					}
-				}
-				if altText != "" {
-					partAlternatives = append(partAlternatives, strings.TrimSpace(altText))
+
+			// Long documents are cut at line boundaries and the batches translated in parallel
+			batches := batchLines(pendingTexts, c.maxChars)
+			results := make([][]lineTranslation, len(batches))
+			// Upstream requests are bounded by the slots of c, not here
+			errs := forEach(ctx, len(batches), len(batches), true, func(ctx context.Context, i int) error {
+				var err error
+				start, end := batches[i][0], batches[i][1]
+				results[i], err = c.translateLines(ctx, r, pendingLangs[start:end], pendingTexts[start:end])
+				return err
+			})
+			if err := firstError(errs); err != nil {
+				return DeepLXTranslationResult{}, err
+			}
+
+			j := 0
+			pendingKeys := make([]CacheKey, len(pending))
+			entries := make([]CacheEntry, len(pending))
+			for _, batch := range results {
+				for _, translation := range batch {
+					i := pending[j]
+					translations[i] = translation
+					pendingKeys[j] = keys[i]
+					entries[j] = CacheEntry{Text: translation.Text, Alternatives: translation.Alternatives, SourceLang: translation.SourceLang}
+					j++
 				}
 			}
+			c.store(ctx, pendingKeys, entries)
 		}
 
-		if partTranslation == "" {
-			return DeepLXTranslationResult{
-				Code:    http.StatusServiceUnavailable,
-				Message: "Translation failed",
-			}, nil
+		for i, translation := range translations {
+			translatedParts[lines[i]] = translation.Text
+			allAlternatives[lines[i]] = translation.Alternatives
+			sourceLangs[lines[i]] = translation.SourceLang
 		}
 
-		translatedParts = append(translatedParts, partTranslation)
-		allAlternatives = append(allAlternatives, partAlternatives)
+		// The language of the first line is reported for the whole text
+		sourceLang = sourceLangs[lines[0]]
+	}
+
+	return c.newResult(r, sourceLang, sourceLangs, translatedParts, allAlternatives, cacheHits, cacheMisses, int(attempts.Load())), nil
+}
+
+// lineLangs returns the source language of every line of r, empty entries are left to DeepL
+func (c *Client) lineLangs(r Request, texts []string) []string {
+	langs := make([]string, len(texts))
+	if r.SourceLang != "auto" && r.SourceLang != "" {
+		for i := range langs {
+			langs[i] = strings.ToUpper(r.SourceLang)
+		}
+		return langs
+	}
+	mode := r.DetectMode
+	if mode == "" {
+		mode = c.detectMode
 	}
+	switch mode {
+	case DetectOnce:
+		lang := detectLang(strings.Join(texts, "\n"))
+		for i := range langs {
+			langs[i] = lang
+		}
+	case DetectPerSegment:
+		for i, text := range texts {
+			langs[i] = detectLang(text)
+		}
+	}
+	return langs
+}
 
+// newResult joins the translated lines of r and their alternatives into a result
+func (c *Client) newResult(r Request, sourceLang string, sourceLangs, translatedParts []string, allAlternatives [][]string, cacheHits, cacheMisses, attempts int) DeepLXTranslationResult {
 	// Join all translated parts with newlines
 	translatedText := strings.Join(translatedParts, "\n")
 
@@ -312,7 +659,11 @@ func TranslateByDeepLX(sourceLang, targetLang, text string, tagHandling string,
 		Data:         translatedText,
 		Alternatives: combinedAlternatives,
 		SourceLang:   sourceLang,
-		TargetLang:   targetLang,
-		Method:       map[bool]string{true: "Pro", false: "Free"}[dlSession != ""],
-	}, nil
+		SourceLangs:  sourceLangs,
+		TargetLang:   r.TargetLang,
+		CacheHits:    cacheHits,
+		CacheMisses:  cacheMisses,
+		Attempts:     attempts,
+		Method:       map[bool]string{true: "Pro", false: "Free"}[c.dlSession != "" || c.pooled],
+	}
 }
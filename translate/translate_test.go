@@ -0,0 +1,660 @@
+package translate_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OwO-Network/DeepLX/translate"
+	"github.com/OwO-Network/DeepLX/translate/deepltest"
+)
+
+func newTestClient(t *testing.T, opts ...translate.Option) (*translate.Client, *deepltest.Server) {
+	t.Helper()
+	server := deepltest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := translate.NewClient(append([]translate.Option{translate.WithBaseURL(server.URL)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client, server
+}
+
+// noRetry makes a failure reach the caller instead of being retried
+var noRetry = translate.WithRetryPolicy(translate.RetryPolicy{MaxAttempts: 1})
+
+// fastRetry retries without slowing tests down
+var fastRetry = translate.WithRetryPolicy(translate.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+
+func TestTranslate(t *testing.T) {
+	client, server := newTestClient(t)
+
+	result, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello world"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Code != http.StatusOK {
+		t.Errorf("Code = %d, want %d", result.Code, http.StatusOK)
+	}
+	if result.Data != "[DE] Hello world" {
+		t.Errorf("Data = %q", result.Data)
+	}
+	if want := []string{"[DE#1] Hello world", "[DE#2] Hello world"}; strings.Join(result.Alternatives, "|") != strings.Join(want, "|") {
+		t.Errorf("Alternatives = %q, want %q", result.Alternatives, want)
+	}
+	if result.SourceLang != "EN" || result.TargetLang != "DE" {
+		t.Errorf("SourceLang, TargetLang = %q, %q", result.SourceLang, result.TargetLang)
+	}
+	if result.Method != "Free" {
+		t.Errorf("Method = %q, want Free", result.Method)
+	}
+	if n := server.CallCount(""); n != 2 {
+		t.Errorf("upstream calls = %d, want 2", n)
+	}
+}
+
+func TestTranslateMultiline(t *testing.T) {
+	client, server := newTestClient(t)
+
+	result, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "FR", Text: "One. Two.\n\nThree"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if want := "[FR] One. [FR] Two.\n\n[FR] Three"; result.Data != want {
+		t.Errorf("Data = %q, want %q", result.Data, want)
+	}
+	if len(result.Alternatives) != 2 {
+		t.Fatalf("Alternatives = %q, want 2 entries", result.Alternatives)
+	}
+	if want := "[FR#1] One. [FR#1] Two.\n\n[FR#1] Three"; result.Alternatives[0] != want {
+		t.Errorf("Alternatives[0] = %q, want %q", result.Alternatives[0], want)
+	}
+
+	// Every line goes through a single split and a single handle_jobs call
+	if n := server.CallCount("LMT_split_text"); n != 1 {
+		t.Errorf("LMT_split_text calls = %d, want 1", n)
+	}
+	if n := server.CallCount("LMT_handle_jobs"); n != 1 {
+		t.Errorf("LMT_handle_jobs calls = %d, want 1", n)
+	}
+	calls := server.Calls()
+	if texts := calls[0].Params.Texts; len(texts) != 2 {
+		t.Errorf("split texts = %q, want the 2 non-blank lines", texts)
+	}
+	if jobs := calls[1].Params.Jobs; len(jobs) != 3 {
+		t.Errorf("jobs = %d, want 3", len(jobs))
+	}
+}
+
+func TestTranslateBlankLines(t *testing.T) {
+	client, server := newTestClient(t)
+
+	result, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "\n  \n"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Data != "\n\n" {
+		t.Errorf("Data = %q", result.Data)
+	}
+	if n := server.CallCount(""); n != 0 {
+		t.Errorf("upstream calls = %d, want 0", n)
+	}
+}
+
+func TestTranslateRegionalVariant(t *testing.T) {
+	client, server := newTestClient(t)
+
+	result, err := client.Translate(translate.Request{SourceLang: "DE", TargetLang: "EN-GB", Text: "Hallo"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Data != "[EN-GB] Hallo" {
+		t.Errorf("Data = %q", result.Data)
+	}
+	calls := server.Calls()
+	jobs := calls[len(calls)-1]
+	if jobs.Params.Lang.TargetLang != "EN" || jobs.Params.CommonJobParams.RegionalVariant != "EN-GB" {
+		t.Errorf("target_lang, regionalVariant = %q, %q", jobs.Params.Lang.TargetLang, jobs.Params.CommonJobParams.RegionalVariant)
+	}
+}
+
+func TestTranslateBrotli(t *testing.T) {
+	client, server := newTestClient(t)
+	server.SetBrotli(true)
+
+	result, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "JA", Text: "Hello"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Data != "[JA] Hello" {
+		t.Errorf("Data = %q", result.Data)
+	}
+}
+
+func TestTranslateSession(t *testing.T) {
+	client, server := newTestClient(t)
+	server.RequireSession("pro-session")
+
+	result, err := client.Session("pro-session").Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Method != "Pro" {
+		t.Errorf("Method = %q, want Pro", result.Method)
+	}
+
+	_, err = client.Session("expired").Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+	if !errors.Is(err, translate.ErrSessionInvalid) {
+		t.Errorf("err = %v, want ErrSessionInvalid", err)
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure deepltest.Failure
+		want    error
+	}{
+		{"rpc rate limit", deepltest.RateLimited, translate.ErrRateLimited},
+		{"http rate limit", deepltest.Failure{StatusCode: http.StatusTooManyRequests, Body: "Too Many Requests"}, translate.ErrRateLimited},
+		{"language", deepltest.Failure{Code: -32600, Message: "Invalid target_lang"}, translate.ErrUnsupportedLanguage},
+		{"garbage", deepltest.Failure{StatusCode: http.StatusBadGateway, Body: "<html>"}, translate.ErrUpstreamProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newTestClient(t, noRetry)
+			server.FailNext("LMT_handle_jobs", tt.failure)
+
+			_, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			var upstreamErr *translate.Error
+			if !errors.As(err, &upstreamErr) || upstreamErr.Method != "LMT_handle_jobs" {
+				t.Errorf("err = %#v, want *translate.Error for LMT_handle_jobs", err)
+			}
+		})
+	}
+}
+
+func TestTranslateEmptyText(t *testing.T) {
+	client, server := newTestClient(t)
+
+	_, err := client.Translate(translate.Request{TargetLang: "DE"})
+	if !errors.Is(err, translate.ErrEmptyText) {
+		t.Errorf("err = %v, want ErrEmptyText", err)
+	}
+	if n := server.CallCount(""); n != 0 {
+		t.Errorf("upstream calls = %d, want 0", n)
+	}
+}
+
+func TestTranslateContext(t *testing.T) {
+	client, server := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.TranslateContext(ctx, translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = client.TranslateContext(ctx, translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	if n := server.CallCount(""); n != 0 {
+		t.Errorf("upstream calls = %d, want 0", n)
+	}
+}
+
+func TestTranslateDetectMode(t *testing.T) {
+	text := "Bonjour tout le monde, comment allez-vous aujourd'hui?\nGuten Morgen, wie geht es Ihnen heute?"
+
+	client, server := newTestClient(t, translate.WithDetectMode(translate.DetectDeepL))
+	server.SetDetectedLang("FR")
+	result, err := client.Translate(translate.Request{TargetLang: "EN", Text: text})
+	if err != nil {
+		t.Fatalf("deepl: %v", err)
+	}
+	if result.SourceLang != "FR" || strings.Join(result.SourceLangs, ",") != "FR,FR" {
+		t.Errorf("deepl: SourceLang = %q, SourceLangs = %q", result.SourceLang, result.SourceLangs)
+	}
+
+	// Every line is detected on its own by default
+	client, server = newTestClient(t)
+	result, err = client.Translate(translate.Request{TargetLang: "EN", Text: text})
+	if err != nil {
+		t.Fatalf("segment: %v", err)
+	}
+	if strings.Join(result.SourceLangs, ",") != "FR,DE" {
+		t.Errorf("segment: SourceLangs = %q, want FR,DE", result.SourceLangs)
+	}
+	if n := server.CallCount("LMT_handle_jobs"); n != 2 {
+		t.Errorf("segment: LMT_handle_jobs calls = %d, want one per language", n)
+	}
+	for _, call := range server.Calls() {
+		if call.Method != "LMT_handle_jobs" {
+			continue
+		}
+		lang := call.Params.Lang.SourceLangComputed
+		if want := map[string]int{"FR": 1, "DE": 1}[lang]; len(call.Params.Jobs) != want {
+			t.Errorf("segment: %s request has %d jobs", lang, len(call.Params.Jobs))
+		}
+	}
+
+	client, server = newTestClient(t, translate.WithDetectMode(translate.DetectOnce))
+	result, err = client.Translate(translate.Request{TargetLang: "EN", Text: "Bonjour tout le monde, comment allez-vous aujourd'hui?\nMerci beaucoup"})
+	if err != nil {
+		t.Fatalf("once: %v", err)
+	}
+	if strings.Join(result.SourceLangs, ",") != "FR,FR" {
+		t.Errorf("once: SourceLangs = %q, want FR,FR", result.SourceLangs)
+	}
+	if n := server.CallCount("LMT_handle_jobs"); n != 1 {
+		t.Errorf("once: LMT_handle_jobs calls = %d, want 1", n)
+	}
+}
+
+func TestTranslateCache(t *testing.T) {
+	client, server := newTestClient(t, translate.WithCache(translate.NewMemoryCache(100, time.Hour)))
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "One\nTwo"}
+
+	first, err := client.Translate(req)
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if first.CacheHits != 0 || first.CacheMisses != 2 {
+		t.Errorf("first: hits, misses = %d, %d", first.CacheHits, first.CacheMisses)
+	}
+
+	second, err := client.Translate(req)
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if second.Data != first.Data || strings.Join(second.Alternatives, "|") != strings.Join(first.Alternatives, "|") {
+		t.Errorf("cached result = %+v, want %+v", second, first)
+	}
+	if second.CacheHits != 2 || second.CacheMisses != 0 {
+		t.Errorf("second: hits, misses = %d, %d", second.CacheHits, second.CacheMisses)
+	}
+	if n := server.CallCount(""); n != 2 {
+		t.Errorf("upstream calls = %d, want 2", n)
+	}
+
+	// Only the changed line goes upstream
+	partial, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "One\nThree"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if partial.Data != "[DE] One\n[DE] Three" || partial.CacheHits != 1 || partial.CacheMisses != 1 {
+		t.Errorf("partial = %+v", partial)
+	}
+	calls := server.Calls()
+	if texts := calls[len(calls)-2].Params.Texts; len(texts) != 1 || texts[0] != "Three" {
+		t.Errorf("split texts = %q, want only the new line", texts)
+	}
+
+	req.NoCache = true
+	if _, err := client.Translate(req); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if n := server.CallCount(""); n != 6 {
+		t.Errorf("upstream calls = %d, want 6 after bypassing the cache", n)
+	}
+}
+
+func TestTranslateFormality(t *testing.T) {
+	client, server := newTestClient(t, translate.WithCache(translate.NewMemoryCache(100, time.Hour)))
+
+	for _, formality := range []translate.Formality{"", translate.FormalityFormal, translate.FormalityFormal} {
+		if _, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "How are you?", Formality: formality}); err != nil {
+			t.Fatalf("Translate: %v", err)
+		}
+	}
+	// The formal translation is cached apart from the default one
+	if n := server.CallCount("LMT_handle_jobs"); n != 2 {
+		t.Errorf("LMT_handle_jobs calls = %d, want 2", n)
+	}
+	calls := server.Calls()
+	if got := calls[len(calls)-1].Params.CommonJobParams.Formality; got != "formal" {
+		t.Errorf("formality = %q, want formal", got)
+	}
+
+	if _, err := translate.ParseFormality("polite"); err == nil {
+		t.Error("ParseFormality accepted polite")
+	}
+}
+
+func TestTranslateWithContext(t *testing.T) {
+	client, server := newTestClient(t, translate.WithCache(translate.NewMemoryCache(100, time.Hour)))
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "It is red. Really.", Context: "What colour is the car?\n\nIt was bought last year."}
+
+	if _, err := client.Translate(req); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	calls := server.Calls()
+	jobs := calls[len(calls)-1].Params.Jobs
+	if len(jobs) != 2 || strings.Join(jobs[0].RawEnContextBefore, "|") != "What colour is the car?|It was bought last year." || jobs[1].RawEnContextBefore[0] != "It is red." {
+		t.Errorf("jobs = %+v", jobs)
+	}
+
+	// Without the context the line is translated again rather than served from the cache
+	req.Context = ""
+	if result, err := client.Translate(req); err != nil || result.CacheHits != 0 {
+		t.Errorf("without context: result = %+v, err = %v", result, err)
+	}
+}
+
+func TestTranslateBeams(t *testing.T) {
+	client, server := newTestClient(t, translate.WithCache(translate.NewMemoryCache(100, time.Hour)))
+	server.SetBeams(8)
+
+	result, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	calls := server.Calls()
+	if beams := calls[len(calls)-1].Params.Jobs[0].PreferredNumBeams; beams != 4 || len(result.Alternatives) != 3 {
+		t.Errorf("default: preferred_num_beams = %d, alternatives = %q", beams, result.Alternatives)
+	}
+
+	// More beams are not served the alternatives cached for fewer
+	result, err = client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello", Beams: 6})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	calls = server.Calls()
+	if beams := calls[len(calls)-1].Params.Jobs[0].PreferredNumBeams; beams != 6 || len(result.Alternatives) != 5 || result.CacheHits != 0 {
+		t.Errorf("raised: preferred_num_beams = %d, result = %+v", beams, result)
+	}
+}
+
+func TestTranslateCoalescing(t *testing.T) {
+	client, server := newTestClient(t)
+	release := make(chan struct{})
+	server.SetTranslateFunc(func(text, sourceLang, targetLang string, beam int) string {
+		<-release
+		return deepltest.DefaultTranslate(text, sourceLang, targetLang, beam)
+	})
+
+	const n = 20
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"}
+	results := make(chan translate.DeepLXTranslationResult, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			result, err := client.Translate(req)
+			if err != nil {
+				t.Errorf("Translate: %v", err)
+			}
+			results <- result
+		}()
+	}
+	// Give the callers time to join the first one before upstream answers
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < n; i++ {
+		if result := <-results; result.Data != "[DE] Hello" {
+			t.Errorf("result = %+v", result)
+		}
+	}
+	if calls := server.CallCount("LMT_handle_jobs"); calls != 1 {
+		t.Errorf("LMT_handle_jobs calls = %d, want 1", calls)
+	}
+}
+
+func TestTranslateSessionPool(t *testing.T) {
+	pool, err := translate.NewSessionPool([]string{"first", "second"}, translate.RoundRobin, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := newTestClient(t, translate.WithSessionPool(pool), fastRetry)
+
+	result, err := client.Pooled().Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.Method != "Pro" {
+		t.Errorf("Method = %q, want Pro", result.Method)
+	}
+	calls := server.Calls()
+	if len(calls) != 2 || calls[0].Header.Get("Cookie") != "dl_session=first" || calls[1].Header.Get("Cookie") != "dl_session=second" {
+		t.Errorf("calls did not rotate sessions: %+v", calls)
+	}
+
+	// A rate limited session is benched, the retry and later calls use the other one
+	server.FailNext("LMT_split_text", deepltest.RateLimited)
+	if _, err := client.Pooled().Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Again"}); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if _, err := client.Pooled().Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Once more"}); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	for _, call := range server.Calls()[3:] {
+		if call.Header.Get("Cookie") != "dl_session=second" {
+			t.Errorf("benched session used: %s", call.Header.Get("Cookie"))
+		}
+	}
+	if states := pool.States(); states[0].Status != translate.SessionCooldown || states[1].Status != translate.SessionActive {
+		t.Errorf("states = %+v", states)
+	}
+
+	// The plain client stays on the free API
+	if _, err := client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Free"}); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if cookie := server.Calls()[len(server.Calls())-1].Header.Get("Cookie"); cookie != "" {
+		t.Errorf("free request sent Cookie %q", cookie)
+	}
+}
+
+// newForwardProxy starts an HTTP proxy that forwards requests and counts them
+func newForwardProxy(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy, &hits
+}
+
+func TestTranslateProxyPool(t *testing.T) {
+	good, hits := newForwardProxy(t)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	pool, err := translate.NewProxyPool([]string{dead.URL, good.URL}, translate.RoundRobin, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := newTestClient(t, translate.WithProxyPool(pool), noRetry)
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"}
+
+	// The dead proxy fails until it has been ejected, then everything goes through the good one
+	failures := 0
+	for i := 0; i < 6; i++ {
+		if _, err := client.Translate(req); err != nil {
+			failures++
+		}
+	}
+	if failures != 3 {
+		t.Errorf("failed translations = %d, want 3 before the dead proxy is ejected", failures)
+	}
+	if int(hits.Load()) != server.CallCount("") {
+		t.Errorf("proxy forwarded %d of %d calls", hits.Load(), server.CallCount(""))
+	}
+	if states := pool.States(); states[0].Status != translate.ProxyEjected || states[1].Status != translate.ProxyActive {
+		t.Errorf("states = %+v", states)
+	}
+}
+
+func TestCircuitStatesRedactProxy(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	proxyURL := strings.Replace(dead.URL, "http://", "http://user:secret@", 1)
+	client, _ := newTestClient(t, translate.WithProxy(proxyURL), translate.WithCircuitBreaker(1, time.Minute), noRetry)
+
+	client.Translate(translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"})
+	states := client.CircuitStates()
+	if len(states) != 1 {
+		t.Fatalf("states = %v", states)
+	}
+	for identity := range states {
+		if strings.Contains(identity, "secret") {
+			t.Errorf("identity %q leaks the proxy password", identity)
+		}
+	}
+}
+
+func TestTranslateCircuitBreakerPool(t *testing.T) {
+	broken, brokenHits := newForwardProxy(t)
+	healthy, _ := newForwardProxy(t)
+	pool, err := translate.NewProxyPool([]string{broken.URL, healthy.URL}, translate.RoundRobin, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := newTestClient(t, translate.WithProxyPool(pool), translate.WithCircuitBreaker(1, time.Minute), noRetry)
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"}
+
+	// A 502 through the first proxy opens its circuit without ejecting the proxy
+	server.FailNext("LMT_split_text", deepltest.Failure{StatusCode: http.StatusBadGateway})
+	client.Translate(req)
+	if states := client.CircuitStates(); states[broken.URL] != translate.CircuitOpen {
+		t.Fatalf("circuits = %v", states)
+	}
+
+	// Requests go around the open circuit and the skipped proxy is not charged for them
+	for i := 0; i < 4; i++ {
+		if _, err := client.Translate(req); err != nil {
+			t.Errorf("translation %d: %v", i, err)
+		}
+	}
+	if brokenHits.Load() != 1 {
+		t.Errorf("broken proxy forwarded %d calls, want 1", brokenHits.Load())
+	}
+	if states := pool.States(); states[0].Status != translate.ProxyActive || states[0].Requests != 1 || states[1].Requests != 8 {
+		t.Errorf("states = %+v", states)
+	}
+}
+
+func TestTranslateRetry(t *testing.T) {
+	client, server := newTestClient(t, fastRetry)
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"}
+
+	// A 5xx and a rate limit are retried, the third attempt succeeds
+	server.FailNext("LMT_handle_jobs", deepltest.Failure{StatusCode: http.StatusBadGateway, Body: "<html>"}, deepltest.RateLimited)
+	result, err := client.Translate(req)
+	if err != nil || result.Data != "[DE] Hello" {
+		t.Fatalf("Translate = %+v, %v", result, err)
+	}
+	if result.Attempts != 4 {
+		t.Errorf("Attempts = %d, want 4", result.Attempts)
+	}
+
+	// Attempts are exhausted
+	server.FailNext("LMT_handle_jobs", deepltest.RateLimited, deepltest.RateLimited, deepltest.RateLimited)
+	if _, err := client.Translate(req); !errors.Is(err, translate.ErrRateLimited) {
+		t.Errorf("exhausted: err = %v, want ErrRateLimited", err)
+	}
+
+	// Errors that cannot go away are returned at once
+	calls := server.CallCount("LMT_handle_jobs")
+	server.FailNext("LMT_handle_jobs", deepltest.Failure{Code: -32600, Message: "Invalid target_lang"})
+	if _, err := client.Translate(req); !errors.Is(err, translate.ErrUnsupportedLanguage) || server.CallCount("LMT_handle_jobs") != calls+1 {
+		t.Errorf("language: err = %v, calls = %d", err, server.CallCount("LMT_handle_jobs")-calls)
+	}
+
+	// A Retry-After beyond MaxDelay is not waited for
+	server.FailNext("LMT_handle_jobs", deepltest.Failure{StatusCode: http.StatusTooManyRequests, Body: "slow down", Header: http.Header{"Retry-After": {"60"}}})
+	start := time.Now()
+	_, err = client.Translate(req)
+	var upstreamErr *translate.Error
+	if !errors.As(err, &upstreamErr) || upstreamErr.RetryAfter != time.Minute || time.Since(start) > time.Second {
+		t.Errorf("Retry-After: err = %v after %v", err, time.Since(start))
+	}
+}
+
+func TestTranslateRetryPerMethod(t *testing.T) {
+	client, server := newTestClient(t, fastRetry,
+		translate.WithMethodRetryPolicy("LMT_split_text", translate.RetryPolicy{MaxAttempts: 1}))
+
+	server.FailNext("LMT_split_text", deepltest.RateLimited)
+	if _, err := client.Translate(translate.Request{TargetLang: "DE", Text: "Hello"}); !errors.Is(err, translate.ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited without retry", err)
+	}
+	if n := server.CallCount("LMT_split_text"); n != 1 {
+		t.Errorf("LMT_split_text calls = %d, want 1", n)
+	}
+
+	if _, err := translate.NewClient(translate.WithRetryPolicy(translate.RetryPolicy{})); err == nil {
+		t.Error("NewClient accepted a policy without attempts")
+	}
+}
+
+func TestTranslateRetryCancelled(t *testing.T) {
+	client, server := newTestClient(t, translate.WithRetryPolicy(translate.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute}))
+	server.FailNext("LMT_handle_jobs", deepltest.RateLimited)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.TranslateContext(ctx, translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded during backoff", err)
+	}
+}
+
+func TestTranslateCircuitBreaker(t *testing.T) {
+	client, server := newTestClient(t, noRetry, translate.WithCircuitBreaker(2, 50*time.Millisecond))
+	req := translate.Request{SourceLang: "EN", TargetLang: "DE", Text: "Hello"}
+
+	server.FailNext("LMT_split_text", deepltest.RateLimited, deepltest.RateLimited)
+	client.Translate(req)
+	client.Translate(req)
+
+	// The circuit is open: requests fail without reaching DeepL
+	calls := server.CallCount("")
+	if _, err := client.Translate(req); !errors.Is(err, translate.ErrUpstreamUnavailable) {
+		t.Fatalf("err = %v, want ErrUpstreamUnavailable", err)
+	}
+	if server.CallCount("") != calls {
+		t.Error("open circuit called upstream")
+	}
+	if states := client.CircuitStates(); states["direct"] != translate.CircuitOpen {
+		t.Errorf("states = %v", states)
+	}
+
+	// Other sessions have circuits of their own
+	if _, err := client.Session("other").Translate(req); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.Translate(req); err != nil {
+		t.Fatalf("after cooldown: %v", err)
+	}
+	if states := client.CircuitStates(); len(states) != 0 {
+		t.Errorf("states = %v, want none after recovery", states)
+	}
+}
@@ -12,6 +12,77 @@
 
 package translate
 
+import "strings"
+
+// Request describes a single translation
+type Request struct {
+	SourceLang  string
+	TargetLang  string
+	Text        string
+	TagHandling string
+	DetectMode  DetectMode // Overrides the client default when the source language is auto
+	Formality   Formality  // Empty leaves the register to DeepL
+	Context     string     // Text preceding Text, it is not translated but helps with ambiguities
+	Glossary    string     // Name of a glossary of the official API, other providers ignore it
+	Beams       int        // Translations asked for per sentence, beam 0 and alternatives. Only raises the default
+	NoCache     bool       // Skips the cache lookup, the fresh translation is still stored
+}
+
+// defaultNumBeams is the number of translations asked for per sentence unless Request.Beams is higher
+const defaultNumBeams = 4
+
+// numBeams returns the number of beams to ask DeepL for
+func (r Request) numBeams() int {
+	return max(r.Beams, defaultNumBeams)
+}
+
+// extraBeams returns Request.Beams if it exceeds the default, lines translated with more
+// beams carry more alternatives and are cached apart
+func (r Request) extraBeams() int {
+	if r.Beams > defaultNumBeams {
+		return r.Beams
+	}
+	return 0
+}
+
+// maxContextLines is the number of lines of Request.Context sent upstream
+const maxContextLines = 5
+
+// contextBefore returns the last non-blank lines of the context, oldest first
+func (r Request) contextBefore() []string {
+	var lines []string
+	for _, line := range strings.Split(r.Context, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > maxContextLines {
+		lines = lines[len(lines)-maxContextLines:]
+	}
+	return lines
+}
+
+// DetectMode selects how the source language is detected when it is not given
+type DetectMode string
+
+const (
+	// DetectDeepL uses the language DeepL reports while splitting the text
+	DetectDeepL DetectMode = "deepl"
+	// DetectOnce detects the language of the whole text locally
+	DetectOnce DetectMode = "once"
+	// DetectPerSegment detects the language of every line locally
+	DetectPerSegment DetectMode = "segment"
+)
+
+// Formality selects the register of a translation, DeepL ignores it for
+// target languages that have no formal address
+type Formality string
+
+const (
+	FormalityFormal   Formality = "formal"
+	FormalityInformal Formality = "informal"
+)
+
 // Lang represents the language settings for translation
 type Lang struct {
 	SourceLangComputed string `json:"source_lang_computed,omitempty"`
@@ -23,6 +94,7 @@ type Lang struct {
 type CommonJobParams struct {
 	Mode            string `json:"mode"`
 	RegionalVariant string `json:"regionalVariant,omitempty"`
+	Formality       string `json:"formality,omitempty"`
 }
 
 // Sentence represents a sentence in the translation request
@@ -104,6 +176,10 @@ type DeepLXTranslationResult struct {
 	Data         string   `json:"data"`
 	Alternatives []string `json:"alternatives"`
 	SourceLang   string   `json:"source_lang"`
+	SourceLangs  []string `json:"source_langs,omitempty"` // Language of every line, empty for blank lines
 	TargetLang   string   `json:"target_lang"`
 	Method       string   `json:"method"`
+	CacheHits    int      `json:"-"` // Lines served from the cache
+	CacheMisses  int      `json:"-"` // Lines translated upstream while a cache is configured
+	Attempts     int      `json:"-"` // Upstream requests made, retries included
 }
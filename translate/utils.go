@@ -17,6 +17,8 @@ import (
 	"math/rand"
 	"strings"
 	"time"
+
+	"github.com/abadojack/whatlanggo"
 )
 
 // getICount returns the number of 'i' characters in the text
@@ -60,3 +62,8 @@ func formatPostString(postData *PostData) string {
 func isRichText(text string) bool {
 	return strings.Contains(text, "<") && strings.Contains(text, ">")
 }
+
+// detectLang detects the language of text locally, it returns an empty string if unsure
+func detectLang(text string) string {
+	return strings.ToUpper(whatlanggo.DetectLang(text).Iso6391())
+}